@@ -0,0 +1,140 @@
+package cookie
+
+import "time"
+
+// Batcher is implemented by stores that can apply several changes to a
+// session at once. Buffered sessions use it to write all changes of a request
+// with a single round trip.
+type Batcher interface {
+	// Apply sets and deletes the given fields of a session. A ttl greater
+	// than 0 also sets the time to live of the session.
+	Apply(id string, set map[string][]byte, del []string, ttl time.Duration) error
+}
+
+// buffer holds the values of a buffered session and the changes that weren't
+// written yet.
+type buffer struct {
+	values  map[string][]byte
+	changed map[string][]byte
+	deleted map[string]bool
+	refresh bool
+}
+
+// set buffers a changed value.
+func (b *buffer) set(Name string, value []byte) {
+	if b.changed == nil {
+		b.changed = make(map[string][]byte)
+	}
+
+	b.changed[Name] = value
+	delete(b.deleted, Name)
+}
+
+// del buffers a deleted value.
+func (b *buffer) del(Name string) {
+	if b.deleted == nil {
+		b.deleted = make(map[string]bool)
+	}
+
+	b.deleted[Name] = true
+	delete(b.changed, Name)
+}
+
+// dirty reports if the buffer contains changes that weren't written yet.
+func (b *buffer) dirty() bool {
+	return len(b.changed) > 0 || len(b.deleted) > 0 || b.refresh
+}
+
+// bufferedValue returns a value of a buffered session. All values of the
+// session are loaded from the store when the first value is read.
+func (session *StoreCookie) bufferedValue(Name string) ([]byte, error) {
+	b := &session.buffer
+
+	if value, ok := b.changed[Name]; ok {
+		return value, nil
+	}
+
+	if b.deleted[Name] {
+		return nil, ErrNotFound
+	}
+
+	if b.values == nil {
+		values, err := session.Backend.GetAll(session.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		b.values = values
+	}
+
+	value, ok := b.values[Name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return value, nil
+}
+
+// flush writes the buffered changes to the store. If the store is a Batcher,
+// all changes are written at once. Sessions without changes cause no writes.
+func (session *StoreCookie) flush() error {
+	b := &session.buffer
+	if !b.dirty() {
+		return nil
+	}
+
+	var ttl time.Duration
+	if b.refresh {
+		ttl = session.ttl()
+	}
+
+	var deleted []string
+	for Name := range b.deleted {
+		deleted = append(deleted, Name)
+	}
+
+	if err := applyBatch(session.Backend, session.SessionID, b.changed, deleted, ttl); err != nil {
+		return err
+	}
+
+	if b.values != nil {
+		for Name, value := range b.changed {
+			b.values[Name] = value
+		}
+
+		for _, Name := range deleted {
+			delete(b.values, Name)
+		}
+	}
+
+	b.changed = nil
+	b.deleted = nil
+	b.refresh = false
+
+	return nil
+}
+
+// applyBatch applies the changes to the store. Stores that aren't a Batcher
+// get one call per change.
+func applyBatch(store Store, id string, set map[string][]byte, del []string, ttl time.Duration) error {
+	if batcher, ok := store.(Batcher); ok {
+		return batcher.Apply(id, set, del, ttl)
+	}
+
+	for Name, value := range set {
+		if err := store.Set(id, Name, value); err != nil {
+			return err
+		}
+	}
+
+	for _, Name := range del {
+		if err := store.Delete(id, Name); err != nil {
+			return err
+		}
+	}
+
+	if ttl > 0 {
+		return store.Expire(id, ttl)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package cookie_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingStore counts the calls to the methods of a MemoryStore.
+type countingStore struct {
+	*cookie.MemoryStore
+	calls map[string]int
+}
+
+func (s *countingStore) Get(id, field string) ([]byte, error) {
+	s.calls["Get"]++
+	return s.MemoryStore.Get(id, field)
+}
+
+func (s *countingStore) Set(id, field string, value []byte) error {
+	s.calls["Set"]++
+	return s.MemoryStore.Set(id, field, value)
+}
+
+func (s *countingStore) GetAll(id string) (map[string][]byte, error) {
+	s.calls["GetAll"]++
+	return s.MemoryStore.GetAll(id)
+}
+
+func (s *countingStore) Apply(id string, set map[string][]byte, del []string, ttl time.Duration) error {
+	s.calls["Apply"]++
+	return s.MemoryStore.Apply(id, set, del, ttl)
+}
+
+// failingBatcher is a store that can't write buffered changes.
+type failingBatcher struct {
+	*cookie.MemoryStore
+}
+
+func (s failingBatcher) Apply(id string, set map[string][]byte, del []string, ttl time.Duration) error {
+	return errors.New("store is down")
+}
+
+func TestBuffered(t *testing.T) {
+	Convey("A buffered session should use a single call per request.", t, func() {
+		store := &countingStore{cookie.NewMemoryStore(), make(map[string]int)}
+		newCookie := cookie.New(store, cookie.Buffered())
+
+		w := New(t)
+		tmpCookie, _ := newCookie(w, &http.Request{}, "demo")
+		tmpCookie.SetValue("name", "demo")
+		tmpCookie.SetValue("id", 5)
+		tmpCookie.SetValue("deleted", true)
+		So(tmpCookie.DeleteValue("deleted"), ShouldBeNil)
+
+		Convey("Changes should be visible before they are written", func() {
+			So(tmpCookie.GetString("name"), ShouldEqual, "demo")
+			So(tmpCookie.GetBool("deleted"), ShouldBeFalse)
+			So(store.calls["Set"], ShouldEqual, 0)
+			So(store.calls["Apply"], ShouldEqual, 0)
+		})
+
+		Convey("Store should write all changes at once", func() {
+			tmpCookie.Store()
+			So(store.calls["Apply"], ShouldEqual, 1)
+			So(store.calls["Set"], ShouldEqual, 0)
+
+			value, _ := store.MemoryStore.Get(tmpCookie.GetSessionID(), "id")
+			So(string(value), ShouldEqual, "5")
+
+			_, err := store.MemoryStore.Get(tmpCookie.GetSessionID(), "deleted")
+			So(err, ShouldEqual, cookie.ErrNotFound)
+
+			Convey("An unchanged session should not be written again", func() {
+				tmpCookie.Store()
+				So(store.calls["Apply"], ShouldEqual, 1)
+			})
+
+			Convey("The next request should load all values with one call", func() {
+				c := tmpCookie.GetCookie()
+				r := &http.Request{Header: make(http.Header)}
+				r.AddCookie(&c)
+
+				nextCookie, _ := newCookie(New(t), r, "demo")
+				So(nextCookie.GetString("name"), ShouldEqual, "demo")
+				So(nextCookie.GetUint64("id"), ShouldEqual, 5)
+				So(nextCookie.GetBool("deleted"), ShouldBeFalse)
+				So(store.calls["GetAll"], ShouldEqual, 1)
+				So(store.calls["Get"], ShouldEqual, 0)
+
+				nextCookie.Store()
+				So(store.calls["Apply"], ShouldEqual, 1)
+			})
+		})
+
+		Convey("A buffered session with a timeout should load with one call as well", func() {
+			newCookie := cookie.New(store, cookie.Buffered(), cookie.IdleTimeout(time.Hour))
+			tmpCookie, _ := newCookie(New(t), &http.Request{}, "demo")
+			tmpCookie.SetValue("name", "demo")
+			tmpCookie.Store()
+
+			c := tmpCookie.GetCookie()
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&c)
+
+			store.calls = make(map[string]int)
+			nextCookie, _ := newCookie(New(t), r, "demo")
+			So(nextCookie.GetSessionID(), ShouldEqual, tmpCookie.GetSessionID())
+			So(nextCookie.GetString("name"), ShouldEqual, "demo")
+			So(store.calls["GetAll"], ShouldEqual, 1)
+
+			nextCookie.Store()
+			So(store.calls["Apply"], ShouldEqual, 1)
+		})
+
+		Convey("Errors of the last write should be reported by Err", func() {
+			failing, _ := cookie.New(failingBatcher{cookie.NewMemoryStore()}, cookie.Buffered())(New(t), &http.Request{}, "demo")
+			failing.SetValue("name", "demo")
+			failing.Store()
+
+			So(failing.(*cookie.StoreCookie).Err(), ShouldNotBeNil)
+			So(tmpCookie.(*cookie.StoreCookie).Err(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,18 @@
+// Package cbor encodes the values of sessions as CBOR (RFC 7049). It is a
+// separate package, so only users of the codec depend on the library.
+package cbor
+
+import "github.com/fxamacker/cbor"
+
+// Codec encodes values as CBOR. It implements cookie.Codec.
+type Codec struct{}
+
+// Marshal encodes a value as CBOR.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v, cbor.EncOptions{TimeRFC3339: true})
+}
+
+// Unmarshal decodes a CBOR value.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
@@ -0,0 +1,571 @@
+package cookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// chunkSize is the maximum length of the value of a single http cookie.
+	// Browsers limit a cookie to 4096 bytes including it's name and
+	// attributes.
+	chunkSize = 3800
+	// maxChunks is the maximum number of http cookies a ClientCookie is split
+	// into.
+	maxChunks = 10
+	// chunkPrefix marks a cookie whose value is split into several chunks.
+	// It's followed by the number of chunks.
+	chunkPrefix = "chunks:"
+)
+
+// ErrTooLarge is returned if the values of a ClientCookie don't fit into the
+// http cookies.
+var ErrTooLarge = errors.New("client cookie exceeds the size limit")
+
+// KeyPair holds the keys used to protect a ClientCookie. The HashKey is used
+// to authenticate the cookie with HMAC-SHA256 and should be at least 32 bytes
+// long. If the BlockKey is set, the cookie is also encrypted with AES-GCM. It
+// has to be 16, 24 or 32 bytes long.
+type KeyPair struct {
+	HashKey  []byte
+	BlockKey []byte
+}
+
+// encode protects the payload with the keys and returns the cookie value.
+func (k KeyPair) encode(Name string, payload []byte) (string, error) {
+	if k.BlockKey != nil {
+		aead, err := newAEAD(k.BlockKey)
+		if err != nil {
+			return "", err
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+
+		payload = aead.Seal(nonce, nonce, payload, []byte(Name))
+	}
+
+	data := base64.RawURLEncoding.EncodeToString(payload)
+	mac := base64.RawURLEncoding.EncodeToString(k.sign(Name, data))
+
+	return data + "." + mac, nil
+}
+
+// decode verifies the cookie value and returns the payload.
+func (k KeyPair) decode(Name, data string, mac []byte) ([]byte, bool) {
+	if !hmac.Equal(mac, k.sign(Name, data)) {
+		return nil, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, false
+	}
+
+	if k.BlockKey == nil {
+		return payload, true
+	}
+
+	aead, err := newAEAD(k.BlockKey)
+	if err != nil || len(payload) < aead.NonceSize() {
+		return nil, false
+	}
+
+	nonce, payload := payload[:aead.NonceSize()], payload[aead.NonceSize():]
+	payload, err = aead.Open(nil, nonce, payload, []byte(Name))
+	if err != nil {
+		return nil, false
+	}
+
+	return payload, true
+}
+
+// sign creates the HMAC of a cookie value. The name of the cookie is part of
+// the HMAC, so values can't be moved between cookies.
+func (k KeyPair) sign(Name, data string) []byte {
+	h := hmac.New(sha256.New, k.HashKey)
+	h.Write([]byte(Name + "|" + data))
+
+	return h.Sum(nil)
+}
+
+// newAEAD creates the AES-GCM cipher for a BlockKey.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// clientPayload is the content of a ClientCookie.
+type clientPayload struct {
+	ID      string            `json:"i"`
+	Created int64             `json:"c"`
+	Access  int64             `json:"a"`
+	Values  map[string][]byte `json:"v"`
+}
+
+// ClientCookie is a session that keeps all of it's values in the http cookie
+// itself. The cookie is always authenticated with HMAC, so the client can't
+// change the values. They are only confidential if the KeyPair has a
+// BlockKey, otherwise anyone can read them by decoding the cookie. If the
+// values don't fit into a single cookie, they are split into several cookies.
+//
+// The cookie is written by every call to Store, so it has to be called after
+// the last change and before the response is written.
+type ClientCookie struct {
+	getters
+	Cookie    http.Cookie
+	SessionID string
+	values    map[string][]byte
+	keys      []KeyPair
+	created   time.Time
+	opts      options
+	chunks    int // number of chunk cookies sent by the client
+	isNew     bool
+	err       error
+	w         http.ResponseWriter
+	r         *http.Request
+	name      string
+}
+
+// GetCookie returns the http Cookie of the cookie
+func (session *ClientCookie) GetCookie() http.Cookie {
+	return session.Cookie
+}
+
+// GetSessionID returns the SessionID of the cookie
+func (session *ClientCookie) GetSessionID() string {
+	return session.SessionID
+}
+
+// SetSessionID forces a change of the session-ID
+func (session *ClientCookie) SetSessionID(w http.ResponseWriter, id string) error {
+	session.SessionID = id
+	session.err = session.Save(w)
+
+	return session.err
+}
+
+// GetValue returns a value of the cookie
+func (session *ClientCookie) GetValue(Name string) []byte {
+	value, ok := session.values[Name]
+	if !ok {
+		return []byte{}
+	}
+
+	return value
+}
+
+// lookup returns a value of the cookie or ErrNotFound.
+func (session *ClientCookie) lookup(Name string) ([]byte, error) {
+	value, ok := session.values[Name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return value, nil
+}
+
+// SetValue stores a value in the cookie
+func (session *ClientCookie) SetValue(Name string, Value interface{}) {
+	data, err := encodeValue(session.opts.codec, Value)
+	if err != nil {
+		return
+	}
+
+	session.values[Name] = data
+
+	session.Store()
+}
+
+// SetInterface stores an Interface using the codec of the cookie. Unlike
+// SetValue it encodes byte slices as well.
+func (session *ClientCookie) SetInterface(Name string, Value interface{}) error {
+	ToStore, err := session.opts.codec.Marshal(Value)
+	if err != nil {
+		return err
+	}
+
+	session.SetValue(Name, ToStore)
+
+	return session.err
+}
+
+// Update changes a value of the cookie. The values live in the cookie of the
+// client, so concurrent requests can't be detected and the last response
+// wins.
+func (session *ClientCookie) Update(Name string, value interface{}, f func(found bool) error) error {
+	update, err := updateFunc(session.opts.codec, Name, value, f)
+	if err != nil {
+		return err
+	}
+
+	data, err := update(session.values[Name])
+	if err != nil {
+		return err
+	}
+
+	session.values[Name] = data
+	session.Store()
+
+	return session.err
+}
+
+// DeleteValue deletes a value from the cookie
+func (session *ClientCookie) DeleteValue(Name string) error {
+	delete(session.values, Name)
+
+	session.Store()
+
+	return session.err
+}
+
+// AddFlash adds a flash message to the given category. It can be read once
+// by Flashes.
+func (session *ClientCookie) AddFlash(category FlashCategory, message string) error {
+	return appendFlash(session.Update, category, message)
+}
+
+// Flashes returns the flash messages of the given category and deletes them.
+func (session *ClientCookie) Flashes(category FlashCategory) ([]string, error) {
+	data, err := session.lookup(flashField(category))
+	if err != nil {
+		return decodeFlashes(session.opts.codec, data, err)
+	}
+
+	delete(session.values, flashField(category))
+	session.Store()
+
+	return decodeFlashes(session.opts.codec, data, session.err)
+}
+
+// Remove deletes all values and invalidates the http cookies
+func (session *ClientCookie) Remove(w http.ResponseWriter) {
+	session.opts.fire(EventDestroyed, session.r, session.SessionID, "")
+
+	session.values = make(map[string][]byte)
+	session.SessionID = ""
+	session.Cookie = session.opts.expiredCookie(session.name)
+
+	session.removeHeaders(w)
+	http.SetCookie(w, &session.Cookie)
+	session.expireChunks(w, 1)
+}
+
+// Regenerate assigns a new, random session ID to the cookie and re-issues it.
+func (session *ClientCookie) Regenerate(w http.ResponseWriter) error {
+	oldID := session.SessionID
+	session.SessionID = session.opts.generator(idLength)
+
+	if err := session.Save(w); err != nil {
+		return err
+	}
+
+	session.opts.fire(EventRotated, session.r, session.SessionID, oldID)
+
+	return nil
+}
+
+// GetUser returns the user the cookie was bound to.
+func (session *ClientCookie) GetUser() string {
+	return session.GetString(userField)
+}
+
+// SetUser returns ErrNoIndex. The sessions of a client cookie are only known
+// to the client, so they can't be listed or revoked.
+func (session *ClientCookie) SetUser(user string) error {
+	return ErrNoIndex
+}
+
+// bindUser keeps the user in the cookie without an index, so GetUser returns
+// it. Remember uses it to restore the user of a client cookie.
+func (session *ClientCookie) bindUser(user string) error {
+	session.SetValue(userField, user)
+
+	return session.err
+}
+
+// Store writes the http cookies. Errors are available through Err.
+func (session *ClientCookie) Store() {
+	session.err = session.Save(session.w)
+}
+
+// Err returns the error of the last write of the http cookies.
+func (session *ClientCookie) Err() error {
+	return session.err
+}
+
+// Save encodes the values and writes the http cookies. Cookies written by
+// earlier calls are replaced. It returns ErrTooLarge if the values don't fit
+// into the cookies.
+func (session *ClientCookie) Save(w http.ResponseWriter) error {
+	payload, err := json.Marshal(clientPayload{
+		ID:      session.SessionID,
+		Created: session.created.UnixNano(),
+		Access:  time.Now().UnixNano(),
+		Values:  session.values,
+	})
+	if err != nil {
+		return err
+	}
+
+	value, err := session.keys[0].encode(session.name, payload)
+	if err != nil {
+		return err
+	}
+
+	var parts []string
+	for len(value) > chunkSize {
+		parts = append(parts, value[:chunkSize])
+		value = value[chunkSize:]
+	}
+	parts = append(parts, value)
+
+	if len(parts) > maxChunks {
+		return ErrTooLarge
+	}
+
+	session.removeHeaders(w)
+	defer session.saved()
+
+	if len(parts) == 1 {
+		session.Cookie.Value = parts[0]
+		http.SetCookie(w, &session.Cookie)
+		session.expireChunks(w, 1)
+
+		return nil
+	}
+
+	session.Cookie.Value = chunkPrefix + strconv.Itoa(len(parts))
+	http.SetCookie(w, &session.Cookie)
+
+	for i, part := range parts {
+		c := session.Cookie
+		c.Name = chunkName(session.name, i+1)
+		c.Value = part
+		http.SetCookie(w, &c)
+	}
+
+	session.expireChunks(w, len(parts)+1)
+
+	return nil
+}
+
+// expireChunks invalidates all chunk cookies of the request starting with the
+// given chunk.
+func (session *ClientCookie) expireChunks(w http.ResponseWriter, from int) {
+	for i := from; i <= session.chunks; i++ {
+		c := session.opts.expiredCookie(chunkName(session.name, i))
+		http.SetCookie(w, &c)
+	}
+}
+
+// removeHeaders removes the cookies that were written by an earlier call of
+// Save from the response header.
+func (session *ClientCookie) removeHeaders(w http.ResponseWriter) {
+	headers := w.Header()["Set-Cookie"]
+	result := headers[:0]
+
+	for _, header := range headers {
+		name := header
+		if i := strings.Index(header, "="); i >= 0 {
+			name = header[:i]
+		}
+
+		if name == session.name || isChunk(session.name, name) {
+			continue
+		}
+
+		result = append(result, header)
+	}
+
+	if len(result) == 0 {
+		w.Header().Del("Set-Cookie")
+		return
+	}
+
+	w.Header()["Set-Cookie"] = result
+}
+
+// load reads the values from the cookies of the request. The result is false
+// if the cookies are missing, invalid or expired.
+func (session *ClientCookie) load(cookie *http.Cookie) bool {
+	value := cookie.Value
+
+	if strings.HasPrefix(value, chunkPrefix) {
+		count, err := strconv.Atoi(strings.TrimPrefix(value, chunkPrefix))
+		if err != nil || count < 1 || count > maxChunks {
+			return false
+		}
+
+		session.chunks = count
+
+		var parts []string
+		for i := 1; i <= count; i++ {
+			chunk, err := session.r.Cookie(chunkName(session.name, i))
+			if err != nil {
+				return false
+			}
+			parts = append(parts, chunk.Value)
+		}
+		value = strings.Join(parts, "")
+	}
+
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return false
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return false
+	}
+
+	for _, key := range session.keys {
+		data, ok := key.decode(session.name, value[:i], mac)
+		if !ok {
+			continue
+		}
+
+		var payload clientPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return false
+		}
+
+		created := time.Unix(0, payload.Created)
+		access := time.Unix(0, payload.Access)
+
+		if session.opts.absoluteTimeout > 0 && time.Since(created) > session.opts.absoluteTimeout {
+			return false
+		}
+
+		if session.opts.idleTimeout > 0 && time.Since(access) > session.opts.idleTimeout {
+			return false
+		}
+
+		session.SessionID = payload.ID
+		session.created = created
+		if payload.Values != nil {
+			session.values = payload.Values
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// chunkName returns the name of the n-th chunk cookie.
+func chunkName(Name string, n int) string {
+	return fmt.Sprintf("%s_%d", Name, n)
+}
+
+// saved fires the events of a written cookie.
+func (session *ClientCookie) saved() {
+	if session.isNew {
+		session.isNew = false
+		session.opts.fire(EventCreated, session.r, session.SessionID, "")
+	}
+
+	session.opts.fire(EventSaved, session.r, session.SessionID, "")
+}
+
+// isChunk reports if the cookie with the given name is a chunk cookie.
+func isChunk(Name, cookie string) bool {
+	if !strings.HasPrefix(cookie, Name+"_") {
+		return false
+	}
+
+	_, err := strconv.Atoi(strings.TrimPrefix(cookie, Name+"_"))
+
+	return err == nil
+}
+
+// NewClientCookie creates a new cookie that keeps all values in the http
+// cookie itself. The first KeyPair is used to write the cookie, all of them
+// are used to read it. This allows the rotation of keys. Missing, invalid or
+// expired cookies result in a new session.
+func NewClientCookie(w http.ResponseWriter, r *http.Request, Name string, keys []KeyPair, opts ...Option) (*ClientCookie, error) {
+	if w == nil {
+		return &ClientCookie{}, errors.New("responseWriter not set")
+	}
+
+	if r == nil {
+		return &ClientCookie{}, errors.New("request not set")
+	}
+
+	if len(keys) == 0 {
+		return &ClientCookie{}, errors.New("no keys set")
+	}
+
+	for _, key := range keys {
+		if len(key.HashKey) == 0 {
+			return &ClientCookie{}, errors.New("hash key not set")
+		}
+
+		if key.BlockKey != nil {
+			if _, err := aes.NewCipher(key.BlockKey); err != nil {
+				return &ClientCookie{}, err
+			}
+		}
+	}
+
+	o := newOptions(opts)
+	policy := o.fingerprintPolicy(Name)
+	Name = o.cookieName(Name)
+
+	session := &ClientCookie{
+		values:  make(map[string][]byte),
+		keys:    keys,
+		created: time.Now(),
+		opts:    o,
+		w:       w,
+		r:       r,
+		name:    Name,
+	}
+	session.getters = getters{session.lookup, session.opts.codec}
+
+	cookie, err := r.Cookie(Name)
+	if err != nil || !session.load(cookie) {
+		session.SessionID = o.generator(idLength)
+		session.created = time.Now()
+		session.values = make(map[string][]byte)
+		session.isNew = true
+	}
+
+	if policy != nil {
+		session.verify(policy)
+	}
+
+	if !session.isNew {
+		o.fire(EventLoaded, r, session.SessionID, "")
+	}
+
+	session.Cookie = o.httpCookie(Name, "", session.created)
+
+	return session, nil
+}
+
+// NewClient returns a CookieFunc that creates cookies which keep all values
+// in the http cookie itself.
+func NewClient(keys []KeyPair, opts ...Option) CookieFunc {
+	return func(w http.ResponseWriter, r *http.Request, Name string) (Cookie, error) {
+		return NewClientCookie(w, r, Name, keys, opts...)
+	}
+}
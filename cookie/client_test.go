@@ -0,0 +1,122 @@
+package cookie_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// nextRequest creates a request that contains the cookies set in w.
+func nextRequest(w *FakeResponse) *http.Request {
+	r := &http.Request{Header: make(http.Header)}
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		if c.Value != "" {
+			r.AddCookie(c)
+		}
+	}
+
+	return r
+}
+
+func TestClientCookie(t *testing.T) {
+	Convey("A client cookie should keep it's values in the http cookie.", t, func() {
+		keys := []cookie.KeyPair{{
+			HashKey:  []byte("01234567890123456789012345678901"),
+			BlockKey: []byte("0123456789012345"),
+		}}
+		newCookie := cookie.NewClient(keys)
+
+		w := New(t)
+		tmpCookie, err := newCookie(w, &http.Request{}, "demo")
+		So(err, ShouldBeNil)
+
+		tmpCookie.SetValue("name", "secret value")
+		tmpCookie.SetValue("id", 5)
+
+		Convey("The values should be available in the next request", func() {
+			nextCookie, err := newCookie(New(t), nextRequest(w), "demo")
+			So(err, ShouldBeNil)
+			So(nextCookie.GetSessionID(), ShouldEqual, tmpCookie.GetSessionID())
+			So(nextCookie.GetString("name"), ShouldEqual, "secret value")
+			So(nextCookie.GetUint64("id"), ShouldEqual, 5)
+		})
+
+		Convey("The values should be encrypted", func() {
+			So(w.Header().Get("Set-Cookie"), ShouldNotContainSubstring, "secret")
+		})
+
+		Convey("Only one Set-Cookie header should be written", func() {
+			So(len(w.Header()["Set-Cookie"]), ShouldEqual, 1)
+		})
+
+		Convey("A modified cookie should result in a new session", func() {
+			r := nextRequest(w)
+			c, _ := r.Cookie("demo")
+			modified := "x" + c.Value[1:]
+			if modified == c.Value {
+				modified = "y" + c.Value[1:]
+			}
+
+			r = &http.Request{Header: make(http.Header)}
+			r.AddCookie(&http.Cookie{Name: "demo", Value: modified})
+
+			nextCookie, err := newCookie(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(nextCookie.GetSessionID(), ShouldNotEqual, tmpCookie.GetSessionID())
+			So(nextCookie.GetString("name"), ShouldEqual, "")
+		})
+
+		Convey("Old keys should still be accepted after a key rotation", func() {
+			rotated := append([]cookie.KeyPair{{HashKey: []byte("new hash key, 32 bytes long.....")}}, keys...)
+			nextCookie, _ := cookie.NewClient(rotated)(New(t), nextRequest(w), "demo")
+			So(nextCookie.GetString("name"), ShouldEqual, "secret value")
+
+			Convey("But unknown keys should not", func() {
+				nextCookie, _ := cookie.NewClient(rotated[:1])(New(t), nextRequest(w), "demo")
+				So(nextCookie.GetString("name"), ShouldEqual, "")
+			})
+		})
+
+		Convey("Large values should be split into several cookies", func() {
+			w := New(t)
+			tmpCookie, _ := newCookie(w, &http.Request{}, "demo")
+			tmpCookie.SetValue("large", strings.Repeat("a", 10000))
+			So(len(w.Header()["Set-Cookie"]), ShouldBeGreaterThan, 1)
+
+			nextCookie, _ := newCookie(New(t), nextRequest(w), "demo")
+			So(nextCookie.GetString("large"), ShouldEqual, strings.Repeat("a", 10000))
+
+			Convey("And the chunks should be removed if they are no longer needed", func() {
+				next := New(t)
+				nextCookie, _ := newCookie(next, nextRequest(w), "demo")
+				So(nextCookie.DeleteValue("large"), ShouldBeNil)
+
+				headers := strings.Join(next.Header()["Set-Cookie"], "\n")
+				So(headers, ShouldContainSubstring, "demo_1=;")
+				So(headers, ShouldContainSubstring, "demo_2=;")
+			})
+		})
+
+		Convey("Values that don't fit into the cookies should be rejected", func() {
+			clientCookie := tmpCookie.(*cookie.ClientCookie)
+			err := clientCookie.SetInterface("huge", strings.Repeat("a", 100000))
+			So(err, ShouldEqual, cookie.ErrTooLarge)
+		})
+
+		Convey("An expired cookie should result in a new session", func() {
+			newCookie := cookie.NewClient(keys, cookie.AbsoluteTimeout(20*time.Millisecond))
+			w := New(t)
+			tmpCookie, _ := newCookie(w, &http.Request{}, "demo")
+			tmpCookie.SetValue("name", "demo")
+
+			time.Sleep(30 * time.Millisecond)
+			nextCookie, _ := newCookie(New(t), nextRequest(w), "demo")
+			So(nextCookie.GetString("name"), ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package cookie
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec converts the values of a session into bytes and back. The typed
+// getters and setters of all cookies use the codec of their store, so a value
+// reads the same no matter which setter wrote it. Byte slices that are passed
+// to SetValue are stored as they are.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values as JSON. It is the default codec.
+type JSONCodec struct{}
+
+// Marshal encodes a value as JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes a JSON value.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes values with encoding/gob. Custom types have to be
+// registered with gob.Register if they are stored as interface values.
+// Signed and unsigned integers can't be read as each other.
+type GobCodec struct{}
+
+// Marshal encodes a value with gob.
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a gob value.
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,118 @@
+package cookie_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type codecUser struct {
+	Name  string
+	Roles []string
+}
+
+// testCodec checks that values read the same, no matter if they were written
+// by SetValue or SetInterface.
+func testCodec(t *testing.T, name string, codec cookie.Codec) {
+	keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+	backends := map[string]cookie.CookieFunc{
+		"memory":   cookie.NewMemory(nil, cookie.ValueCodec(codec)),
+		"buffered": cookie.NewMemory(nil, cookie.ValueCodec(codec), cookie.Buffered()),
+		"client":   cookie.NewClient(keys, cookie.ValueCodec(codec)),
+	}
+
+	created := time.Unix(1500000000, 123456789)
+
+	for backend, newCookie := range backends {
+		Convey("The "+name+" codec should round-trip the values of the "+backend+" cookie.", t, func() {
+			c, err := newCookie(New(t), &http.Request{}, "demo")
+			So(err, ShouldBeNil)
+
+			for _, set := range []func(string, interface{}){
+				c.SetValue,
+				func(Name string, Value interface{}) { So(c.SetInterface(Name, Value), ShouldBeNil) },
+			} {
+				set("uint", uint64(5))
+				set("int", int64(-5))
+				set("string", "demo")
+				set("bool", true)
+				set("float", 1.5)
+				set("time", created)
+				set("duration", time.Minute)
+				set("uints", []uint64{1, 2})
+				set("ints", []int64{-1, 2})
+				set("strings", []string{"a", "b"})
+				set("user", codecUser{"demo", []string{"admin"}})
+
+				So(c.GetUint64("uint"), ShouldEqual, 5)
+				So(c.GetInt64("int"), ShouldEqual, -5)
+				So(c.GetString("string"), ShouldEqual, "demo")
+				So(c.GetBool("bool"), ShouldBeTrue)
+				So(c.GetFloat64("float"), ShouldEqual, 1.5)
+				So(c.GetTime("time").Equal(created), ShouldBeTrue)
+				So(c.GetDuration("duration"), ShouldEqual, time.Minute)
+				So(c.GetUint64Array("uints"), ShouldResemble, []uint64{1, 2})
+				So(c.GetInt64Array("ints"), ShouldResemble, []int64{-1, 2})
+				So(c.GetStringArray("strings"), ShouldResemble, []string{"a", "b"})
+
+				var user codecUser
+				So(c.GetInterface("user", &user), ShouldBeNil)
+				So(user, ShouldResemble, codecUser{"demo", []string{"admin"}})
+
+				var s string
+				So(c.GetInterface("string", &s), ShouldBeNil)
+				So(s, ShouldEqual, "demo")
+			}
+
+			Convey("Byte slices should be stored as they are", func() {
+				c.SetValue("raw", []byte("plain"))
+				So(string(c.GetValue("raw")), ShouldEqual, "plain")
+				So(c.GetString("raw"), ShouldEqual, "plain")
+
+				_, found, err := c.LookupString("raw")
+				So(found, ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Flash messages should use the codec", func() {
+				So(c.AddFlash(cookie.FlashInfo, "hello"), ShouldBeNil)
+
+				messages, err := c.Flashes(cookie.FlashInfo)
+				So(err, ShouldBeNil)
+				So(messages, ShouldResemble, []string{"hello"})
+			})
+		})
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	testCodec(t, "JSON", cookie.JSONCodec{})
+	testCodec(t, "gob", cookie.GobCodec{})
+
+	Convey("The JSON codec should read numbers as any numeric type.", t, func() {
+		c, _ := cookie.NewMemory(nil)(New(t), &http.Request{}, "demo")
+		c.SetValue("id", 5)
+
+		So(c.GetUint64("id"), ShouldEqual, 5)
+		So(c.GetInt64("id"), ShouldEqual, 5)
+		So(c.GetFloat64("id"), ShouldEqual, 5)
+		So(c.GetString("id"), ShouldEqual, "5")
+	})
+
+	Convey("Sessions with timeouts should work with every codec.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store, cookie.ValueCodec(cookie.GobCodec{}), cookie.IdleTimeout(time.Hour))
+
+		w := New(t)
+		c, _ := newCookie(w, &http.Request{}, "demo")
+		c.SetValue("name", "demo")
+
+		next, _ := newCookie(New(t), nextRequest(w), "demo")
+		So(next.GetSessionID(), ShouldEqual, c.GetSessionID())
+		So(next.GetString("name"), ShouldEqual, "demo")
+	})
+}
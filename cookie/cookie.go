@@ -1,24 +1,24 @@
-// +build redis
-
 package cookie
 
 import (
 	"net/http"
-
-	"github.com/garyburd/redigo/redis"
+	"time"
 )
 
 // CookieFunc is the function definition of how a function for cookies should
-// look like. It requires the Responsewriter, Request, Name of the Cookie and
-// the connection to the Redis pool.
-type CookieFunc func(http.ResponseWriter, *http.Request, string, *redis.Pool) (Cookie, error)
+// look like. It requires the Responsewriter, Request and Name of the Cookie.
+// The backend that holds the values is bound when the CookieFunc is created.
+type CookieFunc func(http.ResponseWriter, *http.Request, string) (Cookie, error)
 
 // Cookie is the interface to define the cookie used by store values.
+// The Get methods return the zero value if a value is missing or invalid. The
+// Lookup methods also report if the value was found and return the errors of
+// the backend and the decoding.
 type Cookie interface {
 	GetCookie() http.Cookie
 	//GetConn() redis.PubSubConn
 	GetSessionID() string
-	SetSessionID(http.ResponseWriter, string)
+	SetSessionID(http.ResponseWriter, string) error
 	GetValue(string) []byte
 	SetValue(string, interface{})
 	GetUint64(string) uint64
@@ -27,8 +27,29 @@ type Cookie interface {
 	GetBool(string) bool
 	SetInterface(string, interface{}) error
 	GetInterface(string, interface{}) error
+	Update(string, interface{}, func(bool) error) error
 	GetUint64Array(string) []uint64
+	GetInt64Array(string) []int64
+	GetStringArray(string) []string
+	GetFloat64(string) float64
+	GetTime(string) time.Time
+	GetDuration(string) time.Duration
+	LookupUint64(string) (uint64, bool, error)
+	LookupInt64(string) (int64, bool, error)
+	LookupString(string) (string, bool, error)
+	LookupBool(string) (bool, bool, error)
+	LookupFloat64(string) (float64, bool, error)
+	LookupTime(string) (time.Time, bool, error)
+	LookupDuration(string) (time.Duration, bool, error)
+	LookupUint64Array(string) ([]uint64, bool, error)
+	LookupInt64Array(string) ([]int64, bool, error)
+	LookupStringArray(string) ([]string, bool, error)
 	DeleteValue(string) error
+	AddFlash(FlashCategory, string) error
+	Flashes(FlashCategory) ([]string, error)
 	Remove(http.ResponseWriter)
+	Regenerate(http.ResponseWriter) error
+	GetUser() string
+	SetUser(string) error
 	Store()
 }
@@ -1,11 +1,9 @@
-// +build redis
-
 package cookie
 
 import (
 	"net/http"
-
-	"github.com/garyburd/redigo/redis"
+	"reflect"
+	"time"
 )
 
 // DummyCookie returns the http Cookie of the cookie
@@ -25,8 +23,9 @@ func (d *DummyCookie) GetSessionID() string {
 }
 
 // SetSessionID forces a change of the session-ID
-func (d *DummyCookie) SetSessionID(w http.ResponseWriter, id string) {
+func (d *DummyCookie) SetSessionID(w http.ResponseWriter, id string) error {
 	d.SessionID = id
+	return nil
 }
 
 // GetValue reads a value from redis and returns it
@@ -41,26 +40,22 @@ func (d *DummyCookie) SetValue(Name string, value interface{}) {
 
 // GetUint64 reads a value from redis and returs it as uint64
 func (d *DummyCookie) GetUint64(Name string) uint64 {
-	result, _ := d.Values[Name].(uint64)
-	return result
+	return d.getters().GetUint64(Name)
 }
 
 // GetBool reads a value from redis and returns it as bool
 func (d *DummyCookie) GetBool(Name string) bool {
-	result, _ := d.Values[Name].(bool)
-	return result
+	return d.getters().GetBool(Name)
 }
 
 // GetInt64 reads a value from redis and returns it as int64
 func (d *DummyCookie) GetInt64(Name string) int64 {
-	result, _ := d.Values[Name].(int64)
-	return result
+	return d.getters().GetInt64(Name)
 }
 
 // GetString reads a value from redis and returns it as string
 func (d *DummyCookie) GetString(Name string) string {
-	result, _ := d.Values[Name].(string)
-	return result
+	return d.getters().GetString(Name)
 }
 
 // SetInterface stores an Interface using JSON encoding
@@ -71,14 +66,130 @@ func (d *DummyCookie) SetInterface(Name string, Value interface{}) error {
 
 // GetInterface reads a JSON value from redis and binds it to the o interface
 func (d *DummyCookie) GetInterface(Name string, o interface{}) error {
-	o = d.Values[Name]
+	return d.getters().GetInterface(Name, o)
+}
+
+// Update changes a value of the dummy. The value is kept as it is, not encoded.
+func (d *DummyCookie) Update(Name string, value interface{}, f func(found bool) error) error {
+	update, err := updateFunc(JSONCodec{}, Name, value, f)
+	if err != nil {
+		return err
+	}
+
+	old, err := d.getters().lookup(Name)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	if _, err := update(old); err != nil {
+		return err
+	}
+
+	d.Values[Name] = reflect.ValueOf(value).Elem().Interface()
+
 	return nil
 }
 
 // GetUint64Array reads a value from redis and returns it as uint64 array
 func (d *DummyCookie) GetUint64Array(Name string) []uint64 {
-	result, _ := d.Values[Name].([]uint64)
-	return result
+	return d.getters().GetUint64Array(Name)
+}
+
+// getters returns the typed getters for the values of the dummy.
+func (d *DummyCookie) getters() getters {
+	return getters{func(Name string) ([]byte, error) {
+		value, ok := d.Values[Name]
+		if !ok {
+			return nil, ErrNotFound
+		}
+
+		return encodeValue(JSONCodec{}, value)
+	}, JSONCodec{}}
+}
+
+// GetInt64Array reads a value and returns it as int64 array
+func (d *DummyCookie) GetInt64Array(Name string) []int64 {
+	return d.getters().GetInt64Array(Name)
+}
+
+// GetStringArray reads a value and returns it as string array
+func (d *DummyCookie) GetStringArray(Name string) []string {
+	return d.getters().GetStringArray(Name)
+}
+
+// GetFloat64 reads a value and returns it as float64
+func (d *DummyCookie) GetFloat64(Name string) float64 {
+	return d.getters().GetFloat64(Name)
+}
+
+// GetTime reads a value and returns it as time.Time
+func (d *DummyCookie) GetTime(Name string) time.Time {
+	return d.getters().GetTime(Name)
+}
+
+// GetDuration reads a value and returns it as time.Duration
+func (d *DummyCookie) GetDuration(Name string) time.Duration {
+	return d.getters().GetDuration(Name)
+}
+
+// LookupUint64 reads a value and returns it as uint64. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupUint64(Name string) (uint64, bool, error) {
+	return d.getters().LookupUint64(Name)
+}
+
+// LookupInt64 reads a value and returns it as int64. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupInt64(Name string) (int64, bool, error) {
+	return d.getters().LookupInt64(Name)
+}
+
+// LookupString reads a value and returns it as string. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupString(Name string) (string, bool, error) {
+	return d.getters().LookupString(Name)
+}
+
+// LookupBool reads a value and returns it as bool. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupBool(Name string) (bool, bool, error) {
+	return d.getters().LookupBool(Name)
+}
+
+// LookupFloat64 reads a value and returns it as float64. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupFloat64(Name string) (float64, bool, error) {
+	return d.getters().LookupFloat64(Name)
+}
+
+// LookupTime reads a value and returns it as time.Time. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupTime(Name string) (time.Time, bool, error) {
+	return d.getters().LookupTime(Name)
+}
+
+// LookupDuration reads a value and returns it as time.Duration. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupDuration(Name string) (time.Duration, bool, error) {
+	return d.getters().LookupDuration(Name)
+}
+
+// LookupUint64Array reads a value and returns it as uint64 array. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupUint64Array(Name string) ([]uint64, bool, error) {
+	return d.getters().LookupUint64Array(Name)
+}
+
+// LookupInt64Array reads a value and returns it as int64 array. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupInt64Array(Name string) ([]int64, bool, error) {
+	return d.getters().LookupInt64Array(Name)
+}
+
+// LookupStringArray reads a value and returns it as string array. It also reports if
+// the value was found.
+func (d *DummyCookie) LookupStringArray(Name string) ([]string, bool, error) {
+	return d.getters().LookupStringArray(Name)
 }
 
 // DeleteValue deletes a value from redis
@@ -86,15 +197,44 @@ func (d *DummyCookie) DeleteValue(Name string) error {
 	return nil
 }
 
+// AddFlash adds a flash message to the given category
+func (d *DummyCookie) AddFlash(category FlashCategory, message string) error {
+	return appendFlash(d.Update, category, message)
+}
+
+// Flashes returns the flash messages of the given category and deletes them
+func (d *DummyCookie) Flashes(category FlashCategory) ([]string, error) {
+	result, _, err := d.getters().LookupStringArray(flashField(category))
+	delete(d.Values, flashField(category))
+
+	return result, err
+}
+
 // Remove deletes all entries in redis. It also invalidates the http cookie
 func (d *DummyCookie) Remove(w http.ResponseWriter) {}
 
+// Regenerate is a dummy function
+func (d *DummyCookie) Regenerate(w http.ResponseWriter) error {
+	return nil
+}
+
+// GetUser returns the user the cookie belongs to
+func (d *DummyCookie) GetUser() string {
+	return d.GetString(userField)
+}
+
+// SetUser binds the cookie to a user
+func (d *DummyCookie) SetUser(user string) error {
+	d.Values[userField] = user
+	return nil
+}
+
 // Store is a dummy function
 func (d *DummyCookie) Store() {}
 
 // NewDummyCookie creates a new dummy cookie
 func NewDummyCookie(Values map[string]interface{}, SessionID string) CookieFunc {
-	return func(w http.ResponseWriter, r *http.Request, Name string, Conn *redis.Pool) (Cookie, error) {
+	return func(w http.ResponseWriter, r *http.Request, Name string) (Cookie, error) {
 		return &DummyCookie{
 			Values:    Values,
 			SessionID: SessionID,
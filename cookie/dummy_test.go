@@ -1,7 +1,9 @@
 package cookie_test
 
 import (
+	"fmt"
 	"net/http"
+	"sync"
 	"testing"
 
 	"github.com/anihex/server-utils/cookie"
@@ -23,6 +25,88 @@ func TestMemory(t *testing.T) {
 			So(finalCookie, ShouldHaveSameTypeAs, &cookie.MemoryCookie{})
 			So(err, ShouldBeNil)
 		})
+
+		Convey("New sessions should start with the given values", func() {
+			tmpCookie, _ := tmpFunc(New(t), &http.Request{}, "demo")
+			So(tmpCookie.GetString("license"), ShouldEqual, "12345-12345-12345-12345-12345")
+			So(tmpCookie.GetUint64("license_id"), ShouldEqual, 1)
+			So(tmpCookie.GetString("client_type"), ShouldEqual, "user")
+		})
+
+		Convey("Values should be readable by their typed getters", func() {
+			tmpCookie, _ := tmpFunc(New(t), &http.Request{}, "demo")
+			tmpCookie.SetValue("bool", true)
+			tmpCookie.SetValue("int", int64(-5))
+			tmpCookie.SetValue("array", []uint64{1, 2, 3})
+
+			So(tmpCookie.GetBool("bool"), ShouldBeTrue)
+			So(tmpCookie.GetInt64("int"), ShouldEqual, -5)
+			So(tmpCookie.GetUint64Array("array"), ShouldResemble, []uint64{1, 2, 3})
+
+			var target struct{ Name string }
+			So(tmpCookie.SetInterface("struct", struct{ Name string }{"demo"}), ShouldBeNil)
+			So(tmpCookie.GetInterface("struct", &target), ShouldBeNil)
+			So(target.Name, ShouldEqual, "demo")
+
+			So(tmpCookie.DeleteValue("bool"), ShouldBeNil)
+			So(tmpCookie.GetBool("bool"), ShouldBeFalse)
+		})
+
+		Convey("The session cookie should be sent once and reused on the next request", func() {
+			w := New(t)
+			tmpCookie, _ := tmpFunc(w, &http.Request{}, "demo")
+			tmpCookie.SetValue("name", "demo")
+
+			c := tmpCookie.GetCookie()
+			So(w.Header().Get("Set-Cookie"), ShouldStartWith, "demo="+c.Value)
+
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&c)
+			nextCookie, err := tmpFunc(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(nextCookie.GetSessionID(), ShouldEqual, tmpCookie.GetSessionID())
+			So(nextCookie.GetString("name"), ShouldEqual, "demo")
+		})
+
+		Convey("Removing a session should drop all of it's values", func() {
+			w := New(t)
+			tmpCookie, _ := tmpFunc(w, &http.Request{}, "demo")
+			c := tmpCookie.GetCookie()
+			tmpCookie.SetValue("name", "demo")
+			tmpCookie.Remove(w)
+
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&c)
+			nextCookie, _ := tmpFunc(New(t), r, "demo")
+			So(nextCookie.GetString("name"), ShouldEqual, "")
+		})
+
+		Convey("Concurrent requests of a session should be safe", func() {
+			tmpCookie, _ := tmpFunc(New(t), &http.Request{}, "demo")
+			tmpCookie.SetValue("name", "demo")
+			tmpCookie.Store()
+			c := tmpCookie.GetCookie()
+
+			// Every request has it's own cookie, they share the store
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					r := &http.Request{Header: make(http.Header)}
+					r.AddCookie(&c)
+					nextCookie, _ := tmpFunc(New(t), r, "demo")
+					nextCookie.SetValue(fmt.Sprintf("key%d", i), i)
+					nextCookie.GetInt64(fmt.Sprintf("key%d", i))
+				}(i)
+			}
+			wg.Wait()
+
+			for i := 0; i < 50; i++ {
+				So(tmpCookie.GetInt64(fmt.Sprintf("key%d", i)), ShouldEqual, i)
+			}
+		})
 	})
 }
 
@@ -0,0 +1,273 @@
+package cookie
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+// fingerprintField is the field of a session that holds the fingerprint of the
+// client that created it.
+const fingerprintField = "_fingerprint"
+
+// Default sizes of the network prefix of a fingerprint. Clients often get a
+// new address of the same network, e.g. after a reconnect.
+const (
+	defaultIPv4Bits = 24
+	defaultIPv6Bits = 64
+)
+
+// FingerprintAction decides what happens to a session that is used by a
+// client with another fingerprint.
+type FingerprintAction int
+
+// The actions of a FingerprintPolicy.
+const (
+	// FingerprintLog only logs the mismatch.
+	FingerprintLog FingerprintAction = iota
+	// FingerprintReauth keeps the values of the session, but removes the user
+	// and gives the session a new ID, so the user has to log in again.
+	FingerprintReauth
+	// FingerprintReject destroys the session, the request gets a new one.
+	FingerprintReject
+)
+
+// String returns the name of the action.
+func (a FingerprintAction) String() string {
+	switch a {
+	case FingerprintLog:
+		return "log"
+	case FingerprintReauth:
+		return "reauth"
+	case FingerprintReject:
+		return "reject"
+	}
+
+	return "unknown"
+}
+
+// FingerprintPolicy binds sessions to the client that created them. The
+// fingerprint is the network prefix of the IP of the client and a hash of it's
+// user agent. A zero size of a prefix uses /24 for IPv4 and /64 for IPv6.
+// Mismatches are logged as warnings to the Logger, or to tools.DefaultLogger
+// if it is nil. The entries contain the name of the cookie, a hash of the
+// session ID, the user, the client and both fingerprints.
+//
+// The IP is read with tools.GetIP, so the headers X-Real-IP and
+// X-Forwarded-For have to be set by a trusted proxy.
+type FingerprintPolicy struct {
+	Action   FingerprintAction
+	IPv4Bits int
+	IPv6Bits int
+	Logger   tools.Logger
+}
+
+// defaultFingerprintLogger logs the mismatches of policies without a Logger.
+var defaultFingerprintLogger = tools.NewStdLogger(tools.DefaultLogger)
+
+// Fingerprint binds the sessions to the fingerprint of the client. Without
+// names the policy is used for every cookie, otherwise only for the cookies
+// with the given names. A policy for a name wins over the one for every
+// cookie.
+func Fingerprint(p FingerprintPolicy, names ...string) Option {
+	return func(o *options) {
+		if o.fingerprints == nil {
+			o.fingerprints = make(map[string]*FingerprintPolicy)
+		}
+
+		if len(names) == 0 {
+			names = []string{""}
+		}
+
+		for _, Name := range names {
+			o.fingerprints[Name] = &p
+		}
+	}
+}
+
+// fingerprintPolicy returns the policy of the cookie with the given name. The
+// result is nil if sessions aren't bound to the client.
+func (o options) fingerprintPolicy(Name string) *FingerprintPolicy {
+	if p, ok := o.fingerprints[Name]; ok {
+		return p
+	}
+
+	return o.fingerprints[""]
+}
+
+// fingerprint returns the fingerprint of the client of a request.
+func (p *FingerprintPolicy) fingerprint(r *http.Request) []byte {
+	sum := sha256.Sum256([]byte(r.UserAgent()))
+
+	return []byte(p.network(tools.GetIP(r)) + " " + hex.EncodeToString(sum[:]))
+}
+
+// network returns the network prefix of an address. Addresses that can't be
+// parsed are used as they are.
+func (p *FingerprintPolicy) network(addr string) string {
+	// X-Forwarded-For holds a list, the first address is the client
+	addr = strings.TrimSpace(strings.Split(addr, ",")[0])
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+
+	bits, size, defaultBits := p.IPv6Bits, 128, defaultIPv6Bits
+	if ip.To4() != nil {
+		ip, bits, size, defaultBits = ip.To4(), p.IPv4Bits, 32, defaultIPv4Bits
+	}
+
+	if bits <= 0 || bits > size {
+		bits = defaultBits
+	}
+
+	return ip.Mask(net.CIDRMask(bits, size)).String() + "/" + strconv.Itoa(bits)
+}
+
+// mismatch logs that a session was used by another client. The session ID
+// is the secret of the cookie, so only a hash of it is logged.
+func (p *FingerprintPolicy) mismatch(r *http.Request, Name, id, user string, stored, current []byte) {
+	logger := p.Logger
+	if logger == nil {
+		logger = defaultFingerprintLogger
+	}
+
+	sum := sha256.Sum256([]byte(id))
+
+	fields := []tools.Field{
+		tools.F("cookie", Name),
+		tools.F("session", hex.EncodeToString(sum[:8])),
+		tools.F("remote_ip", tools.ClientIP(r)),
+		tools.F("user_agent", r.UserAgent()),
+		tools.F("fingerprint", string(current)),
+		tools.F("stored_fingerprint", string(stored)),
+		tools.F("action", p.Action.String()),
+	}
+
+	if user != "" {
+		fields = append(fields, tools.F("user", user))
+	}
+
+	logger.Log(r.Context(), tools.LevelWarn, "session used by another client", fields...)
+}
+
+// setInternal writes an internal field of the session. Unlike SetValue it
+// doesn't send the http cookie.
+func (session *StoreCookie) setInternal(Name string, value []byte) error {
+	if session.opts.buffered {
+		session.buffer.set(Name, value)
+		return nil
+	}
+
+	return session.Backend.Set(session.SessionID, Name, value)
+}
+
+// deleteInternal deletes an internal field of the session. Unlike DeleteValue
+// it doesn't send the http cookie.
+func (session *StoreCookie) deleteInternal(Name string) error {
+	if session.opts.buffered {
+		session.buffer.del(Name)
+		return nil
+	}
+
+	return session.Backend.Delete(session.SessionID, Name)
+}
+
+// verify compares the fingerprint of the request with the one of the session.
+// It is only called for sessions that exist in the store, new sessions get
+// their fingerprint when they are created. Sessions that were created before
+// the policy was used get the fingerprint of the request. The result is false
+// if the session was destroyed.
+func (session *StoreCookie) verify(p *FingerprintPolicy) (bool, error) {
+	current := p.fingerprint(session.r)
+
+	stored, err := session.getValue(fingerprintField)
+	if err == ErrNotFound {
+		return true, session.setInternal(fingerprintField, current)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if string(stored) == string(current) {
+		return true, nil
+	}
+
+	p.mismatch(session.r, session.name, session.SessionID, session.GetUser(), stored, current)
+
+	switch p.Action {
+	case FingerprintReauth:
+		if user := session.GetUser(); user != "" {
+			if err := session.reindex(user, session.SessionID, ""); err != nil {
+				return false, err
+			}
+
+			if err := session.deleteInternal(userField); err != nil {
+				return false, err
+			}
+		}
+
+		if err := session.Regenerate(session.w); err != nil {
+			return false, err
+		}
+
+		return true, session.setInternal(fingerprintField, current)
+	case FingerprintReject:
+		if err := session.reindex(session.GetUser(), session.SessionID, ""); err != nil {
+			return false, err
+		}
+
+		if err := session.Backend.Destroy(session.SessionID); err != nil {
+			return false, err
+		}
+
+		session.opts.fire(EventDestroyed, session.r, session.SessionID, "")
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// verify compares the fingerprint of the request with the one of the cookie.
+// Client cookies aren't bound to a user, so a mismatch that isn't only logged
+// starts a new session. Reauth keeps the values except the user.
+func (session *ClientCookie) verify(p *FingerprintPolicy) {
+	current := p.fingerprint(session.r)
+
+	stored, ok := session.values[fingerprintField]
+	if ok && string(stored) == string(current) {
+		return
+	}
+
+	if ok {
+		p.mismatch(session.r, session.name, session.SessionID, session.GetUser(), stored, current)
+
+		switch p.Action {
+		case FingerprintReauth:
+			delete(session.values, userField)
+			session.SessionID = session.opts.generator(idLength)
+		case FingerprintReject:
+			session.opts.fire(EventDestroyed, session.r, session.SessionID, "")
+			session.SessionID = session.opts.generator(idLength)
+			session.created = time.Now()
+			session.values = make(map[string][]byte)
+			session.isNew = true
+		default:
+			return
+		}
+	}
+
+	session.values[fingerprintField] = current
+}
@@ -0,0 +1,183 @@
+package cookie_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/anihex/server-utils/tools"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// clientRequest returns a request of a client with the given address and user
+// agent that sends the cookie of a session.
+func clientRequest(c cookie.Cookie, addr, agent string) *http.Request {
+	r := withCookie(c)
+	r.RemoteAddr = addr
+	r.Header.Set("User-Agent", agent)
+
+	return r
+}
+
+func TestFingerprint(t *testing.T) {
+	Convey("Sessions should be bound to the fingerprint of the client.", t, func() {
+		logger := &tools.RecordLogger{}
+
+		store := cookie.NewMemoryStore()
+		policy := cookie.FingerprintPolicy{Logger: logger}
+
+		// start creates a session of the first client
+		start := func(newCookie cookie.CookieFunc) cookie.Cookie {
+			r := &http.Request{Header: make(http.Header), RemoteAddr: "10.0.0.1:4000"}
+			r.Header.Set("User-Agent", "firefox")
+
+			c, _ := newCookie(New(t), r, "demo")
+			c.SetUser("alice")
+			c.SetValue("cart", "book")
+			c.Store()
+
+			return c
+		}
+
+		Convey("Clients of the same network should be accepted", func() {
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour), cookie.Fingerprint(policy))
+			c := start(newCookie)
+
+			next, _ := newCookie(New(t), clientRequest(c, "10.0.0.99:5000", "firefox"), "demo")
+			So(next.GetSessionID(), ShouldEqual, c.GetSessionID())
+			So(logger.Entries(), ShouldBeEmpty)
+		})
+
+		Convey("FingerprintLog should only log a mismatch", func() {
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour), cookie.Fingerprint(policy))
+			c := start(newCookie)
+
+			next, _ := newCookie(New(t), clientRequest(c, "192.168.1.1", "firefox"), "demo")
+			So(next.GetSessionID(), ShouldEqual, c.GetSessionID())
+			So(next.GetUser(), ShouldEqual, "alice")
+
+			So(logger.Entries(), ShouldHaveLength, 1)
+			entry := logger.Entries()[0]
+			So(entry.Level, ShouldEqual, tools.LevelWarn)
+			So(entry.Msg, ShouldEqual, "session used by another client")
+			So(entry.Fields["cookie"], ShouldEqual, "demo")
+			So(entry.Fields["user"], ShouldEqual, "alice")
+			So(entry.Fields["remote_ip"], ShouldEqual, "192.168.1.1")
+			So(entry.Fields["user_agent"], ShouldEqual, "firefox")
+			So(entry.Fields["action"], ShouldEqual, "log")
+			So(entry.Fields["stored_fingerprint"], ShouldStartWith, "10.0.0.0/24 ")
+			So(entry.Fields["fingerprint"], ShouldStartWith, "192.168.1.0/24 ")
+
+			// Only a hash of the session ID is logged
+			So(entry.Fields["session"], ShouldHaveLength, 16)
+			So(entry.Fields["session"], ShouldNotEqual, c.GetSessionID())
+		})
+
+		Convey("FingerprintReauth should keep the values but drop the user", func() {
+			policy.Action = cookie.FingerprintReauth
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour), cookie.Fingerprint(policy))
+			c := start(newCookie)
+
+			next, _ := newCookie(New(t), clientRequest(c, "10.0.0.1", "curl"), "demo")
+			So(next.GetSessionID(), ShouldNotEqual, c.GetSessionID())
+			So(next.GetUser(), ShouldBeEmpty)
+			So(next.GetString("cart"), ShouldEqual, "book")
+
+			sessions, _ := cookie.UserSessions(store, "alice")
+			So(sessions, ShouldBeEmpty)
+
+			// The session belongs to the new client now
+			again, _ := newCookie(New(t), clientRequest(next, "10.0.0.1", "curl"), "demo")
+			So(again.GetSessionID(), ShouldEqual, next.GetSessionID())
+		})
+
+		Convey("FingerprintReject should start a new session", func() {
+			policy.Action = cookie.FingerprintReject
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour), cookie.Fingerprint(policy))
+			c := start(newCookie)
+
+			next, _ := newCookie(New(t), clientRequest(c, "10.0.1.1", "firefox"), "demo")
+			So(next.GetSessionID(), ShouldNotEqual, c.GetSessionID())
+			So(next.GetString("cart"), ShouldBeEmpty)
+
+			_, err := store.Get(c.GetSessionID(), "_created")
+			So(err, ShouldEqual, cookie.ErrNotFound)
+		})
+
+		Convey("Unknown session IDs should not get a fingerprint", func() {
+			newCookie := cookie.New(store, cookie.Fingerprint(policy))
+			planted := strings.Repeat("x", 32)
+
+			r := &http.Request{Header: make(http.Header), RemoteAddr: "10.0.0.1:4000"}
+			r.AddCookie(&http.Cookie{Name: "demo", Value: planted})
+			c, err := newCookie(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(c.GetSessionID(), ShouldNotEqual, planted)
+
+			_, err = store.Get(planted, "_fingerprint")
+			So(err, ShouldEqual, cookie.ErrNotFound)
+		})
+
+		Convey("Policies should be configurable per cookie name", func() {
+			reject := cookie.FingerprintPolicy{Action: cookie.FingerprintReject, Logger: logger}
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour),
+				cookie.Fingerprint(policy), cookie.Fingerprint(reject, "admin"))
+
+			c := start(newCookie)
+			next, _ := newCookie(New(t), clientRequest(c, "10.0.1.1", "firefox"), "demo")
+			So(next.GetSessionID(), ShouldEqual, c.GetSessionID())
+
+			r := &http.Request{Header: make(http.Header), RemoteAddr: "10.0.0.1"}
+			admin, _ := newCookie(New(t), r, "admin")
+			admin.Store()
+
+			httpCookie := admin.GetCookie()
+			r = &http.Request{Header: make(http.Header), RemoteAddr: "10.0.1.1"}
+			r.AddCookie(&httpCookie)
+
+			next, _ = newCookie(New(t), r, "admin")
+			So(next.GetSessionID(), ShouldNotEqual, admin.GetSessionID())
+		})
+
+		Convey("IPv6 clients should be compared by their /64 network", func() {
+			policy.Action = cookie.FingerprintReject
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour), cookie.Fingerprint(policy))
+
+			r := &http.Request{Header: make(http.Header), RemoteAddr: "[2001:db8:1:2::1]:443"}
+			c, _ := newCookie(New(t), r, "demo")
+			c.SetValue("name", "demo")
+			c.Store()
+
+			next, _ := newCookie(New(t), clientRequest(c, "[2001:db8:1:2:ffff::1]:443", ""), "demo")
+			So(next.GetSessionID(), ShouldEqual, c.GetSessionID())
+
+			next, _ = newCookie(New(t), clientRequest(c, "[2001:db8:1:3::1]:443", ""), "demo")
+			So(next.GetSessionID(), ShouldNotEqual, c.GetSessionID())
+		})
+
+		Convey("Client cookies should be bound as well", func() {
+			policy.Action = cookie.FingerprintReject
+			keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+			newCookie := cookie.NewClient(keys, cookie.Fingerprint(policy))
+
+			w := New(t)
+			r := &http.Request{Header: make(http.Header), RemoteAddr: "10.0.0.1"}
+			c, _ := newCookie(w, r, "demo")
+			c.SetValue("cart", "book")
+
+			same := nextRequest(w)
+			same.RemoteAddr = "10.0.0.2"
+			next, _ := newCookie(New(t), same, "demo")
+			So(next.GetString("cart"), ShouldEqual, "book")
+
+			other := nextRequest(w)
+			other.RemoteAddr = "10.0.1.1"
+			next, _ = newCookie(New(t), other, "demo")
+			So(next.GetString("cart"), ShouldBeEmpty)
+			So(next.GetSessionID(), ShouldNotEqual, c.GetSessionID())
+		})
+	})
+}
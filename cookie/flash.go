@@ -0,0 +1,49 @@
+package cookie
+
+import "fmt"
+
+// FlashCategory is the category of a flash message.
+type FlashCategory string
+
+// The default categories of flash messages.
+const (
+	FlashInfo    FlashCategory = "info"
+	FlashSuccess FlashCategory = "success"
+	FlashWarning FlashCategory = "warning"
+	FlashError   FlashCategory = "error"
+)
+
+// flashField returns the field of a session that holds the flash messages of
+// a category.
+func flashField(category FlashCategory) string {
+	return "_flash_" + string(category)
+}
+
+// appendFlash adds a message to the flash messages of a category. It uses the
+// Update method of the cookie, so concurrent requests don't lose messages.
+func appendFlash(update func(string, interface{}, func(bool) error) error, category FlashCategory, message string) error {
+	var messages []string
+
+	return update(flashField(category), &messages, func(found bool) error {
+		messages = append(messages, message)
+		return nil
+	})
+}
+
+// decodeFlashes decodes the flash messages that were taken from a session.
+func decodeFlashes(codec Codec, data []byte, err error) ([]string, error) {
+	if err == ErrNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	if err := codec.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("cookie: can't decode flash messages: %v", err)
+	}
+
+	return result, nil
+}
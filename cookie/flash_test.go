@@ -0,0 +1,112 @@
+package cookie_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlashes(t *testing.T) {
+	keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+	backends := map[string]cookie.CookieFunc{
+		"memory":   cookie.NewMemory(nil),
+		"buffered": cookie.NewMemory(nil, cookie.Buffered()),
+		"client":   cookie.NewClient(keys),
+		"dummy":    cookie.NewDummyCookie(make(map[string]interface{}), "dummy"),
+	}
+
+	for name, newCookie := range backends {
+		Convey("Flash messages of the "+name+" cookie should only be read once.", t, func() {
+			tmpCookie, _ := newCookie(New(t), &http.Request{}, "demo")
+
+			So(tmpCookie.AddFlash(cookie.FlashSuccess, "saved"), ShouldBeNil)
+			So(tmpCookie.AddFlash(cookie.FlashSuccess, "sent"), ShouldBeNil)
+			So(tmpCookie.AddFlash(cookie.FlashError, "failed"), ShouldBeNil)
+
+			messages, err := tmpCookie.Flashes(cookie.FlashSuccess)
+			So(err, ShouldBeNil)
+			So(messages, ShouldResemble, []string{"saved", "sent"})
+
+			messages, err = tmpCookie.Flashes(cookie.FlashSuccess)
+			So(err, ShouldBeNil)
+			So(messages, ShouldBeEmpty)
+
+			messages, err = tmpCookie.Flashes(cookie.FlashError)
+			So(err, ShouldBeNil)
+			So(messages, ShouldResemble, []string{"failed"})
+		})
+	}
+
+	Convey("Concurrent requests should not lose flash messages.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store)
+
+		tmpCookie, _ := newCookie(New(t), &http.Request{}, "demo")
+		tmpCookie.SetValue("name", "demo")
+		tmpCookie.Store()
+		c := tmpCookie.GetCookie()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				r := &http.Request{Header: make(http.Header)}
+				r.AddCookie(&c)
+				nextCookie, _ := newCookie(New(t), r, "demo")
+
+				errs <- nextCookie.AddFlash(cookie.FlashInfo, "hello")
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			So(err, ShouldBeNil)
+		}
+
+		messages, err := tmpCookie.Flashes(cookie.FlashInfo)
+		So(err, ShouldBeNil)
+		So(messages, ShouldHaveLength, 20)
+	})
+
+	Convey("Concurrent requests should not read the same flash messages.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store)
+
+		tmpCookie, _ := newCookie(New(t), &http.Request{}, "demo")
+		tmpCookie.AddFlash(cookie.FlashInfo, "hello")
+		c := tmpCookie.GetCookie()
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		var read int
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				r := &http.Request{Header: make(http.Header)}
+				r.AddCookie(&c)
+				nextCookie, _ := newCookie(New(t), r, "demo")
+
+				messages, _ := nextCookie.Flashes(cookie.FlashInfo)
+
+				mu.Lock()
+				read += len(messages)
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		So(read, ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,106 @@
+package cookie
+
+import (
+	"net/http"
+	"sync"
+)
+
+// EventType is the kind of a session event.
+type EventType int
+
+// The events of a session.
+const (
+	// EventCreated is fired when a new session is written for the first time.
+	EventCreated EventType = iota
+	// EventLoaded is fired when an existing session is loaded by a request.
+	EventLoaded
+	// EventSaved is fired when Store writes the session.
+	EventSaved
+	// EventDestroyed is fired when a session is removed.
+	EventDestroyed
+	// EventRotated is fired when a session gets a new ID.
+	EventRotated
+	// EventExpired is fired when a session expired.
+	EventExpired
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "created"
+	case EventLoaded:
+		return "loaded"
+	case EventSaved:
+		return "saved"
+	case EventDestroyed:
+		return "destroyed"
+	case EventRotated:
+		return "rotated"
+	case EventExpired:
+		return "expired"
+	}
+
+	return "unknown"
+}
+
+// Event describes something that happened to a session. Request is nil if
+// the event doesn't belong to a request, e.g. when Redis reports an expired
+// session. OldID is only set for EventRotated.
+type Event struct {
+	Type      EventType
+	Request   *http.Request
+	SessionID string
+	OldID     string
+}
+
+// Hook is a function that receives the events of sessions.
+type Hook func(Event)
+
+// Hooks is a registry of the hooks that receive session events. It is safe for
+// concurrent use. Hooks are called synchronously in the order they were added,
+// so slow work should be moved into a goroutine.
+type Hooks struct {
+	mu    sync.RWMutex
+	hooks map[EventType][]Hook
+}
+
+// NewHooks creates a new, empty registry.
+func NewHooks() *Hooks {
+	return &Hooks{hooks: make(map[EventType][]Hook)}
+}
+
+// On adds a hook that is called for the given event types. Without types it is
+// called for every event.
+func (h *Hooks) On(f Hook, types ...EventType) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(types) == 0 {
+		types = []EventType{EventCreated, EventLoaded, EventSaved, EventDestroyed, EventRotated, EventExpired}
+	}
+
+	for _, t := range types {
+		h.hooks[t] = append(h.hooks[t], f)
+	}
+}
+
+// Fire calls the hooks of the event type. A nil registry does nothing.
+func (h *Hooks) Fire(e Event) {
+	if h == nil {
+		return
+	}
+
+	h.mu.RLock()
+	hooks := h.hooks[e.Type]
+	h.mu.RUnlock()
+
+	for _, f := range hooks {
+		f(e)
+	}
+}
+
+// fire sends an event of a request to the hooks of the options.
+func (o options) fire(t EventType, r *http.Request, id, oldID string) {
+	o.hooks.Fire(Event{Type: t, Request: r, SessionID: id, OldID: oldID})
+}
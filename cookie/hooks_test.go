@@ -0,0 +1,162 @@
+package cookie_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recorder collects the events of a registry.
+type recorder struct {
+	events []cookie.Event
+}
+
+func (rec *recorder) types() []cookie.EventType {
+	result := make([]cookie.EventType, len(rec.events))
+	for i, e := range rec.events {
+		result[i] = e.Type
+	}
+
+	return result
+}
+
+func newRecorder() (*recorder, *cookie.Hooks) {
+	rec := &recorder{}
+	hooks := cookie.NewHooks()
+	hooks.On(func(e cookie.Event) {
+		rec.events = append(rec.events, e)
+	})
+
+	return rec, hooks
+}
+
+// withCookie returns a request that sends the cookie of a session.
+func withCookie(c cookie.Cookie) *http.Request {
+	httpCookie := c.GetCookie()
+	r := &http.Request{Header: make(http.Header)}
+	r.AddCookie(&httpCookie)
+
+	return r
+}
+
+func TestHooks(t *testing.T) {
+	Convey("Hooks should only receive the events they were added for.", t, func() {
+		hooks := cookie.NewHooks()
+
+		var all, destroyed int
+		hooks.On(func(cookie.Event) { all++ })
+		hooks.On(func(cookie.Event) { destroyed++ }, cookie.EventDestroyed)
+
+		hooks.Fire(cookie.Event{Type: cookie.EventCreated})
+		hooks.Fire(cookie.Event{Type: cookie.EventDestroyed})
+
+		So(all, ShouldEqual, 2)
+		So(destroyed, ShouldEqual, 1)
+
+		var empty *cookie.Hooks
+		So(func() { empty.Fire(cookie.Event{}) }, ShouldNotPanic)
+		So(cookie.EventRotated.String(), ShouldEqual, "rotated")
+	})
+
+	Convey("Store cookies should fire the events of a session.", t, func() {
+		rec, hooks := newRecorder()
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour), cookie.SessionHooks(hooks))
+
+		r := &http.Request{Header: make(http.Header)}
+		c, _ := newCookie(New(t), r, "demo")
+		c.SetValue("name", "demo")
+		c.Store()
+
+		So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventCreated, cookie.EventSaved})
+		So(rec.events[0].SessionID, ShouldEqual, c.GetSessionID())
+		So(rec.events[0].Request, ShouldEqual, r)
+
+		Convey("Loading the session should fire EventLoaded", func() {
+			rec.events = nil
+			loaded, _ := newCookie(New(t), withCookie(c), "demo")
+
+			So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventLoaded})
+			So(rec.events[0].SessionID, ShouldEqual, loaded.GetSessionID())
+		})
+
+		Convey("Regenerate should fire EventRotated with the old ID", func() {
+			rec.events = nil
+			oldID := c.GetSessionID()
+			So(c.Regenerate(New(t)), ShouldBeNil)
+
+			So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventRotated})
+			So(rec.events[0].SessionID, ShouldEqual, c.GetSessionID())
+			So(rec.events[0].OldID, ShouldEqual, oldID)
+		})
+
+		Convey("Remove should fire EventDestroyed", func() {
+			rec.events = nil
+			id := c.GetSessionID()
+			c.Remove(New(t))
+
+			So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventDestroyed})
+			So(rec.events[0].SessionID, ShouldEqual, id)
+		})
+
+		Convey("Sessions past the absolute timeout should fire EventExpired", func() {
+			newCookie := cookie.New(store, cookie.AbsoluteTimeout(time.Hour), cookie.SessionHooks(hooks))
+			old := strconv.FormatInt(time.Now().Add(-2*time.Hour).UnixNano(), 10)
+			store.Set(c.GetSessionID(), "_created", []byte(old))
+
+			rec.events = nil
+			newCookie(New(t), withCookie(c), "demo")
+
+			So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventExpired})
+			So(rec.events[0].SessionID, ShouldEqual, c.GetSessionID())
+		})
+	})
+
+	Convey("Purge should fire EventExpired for every purged session.", t, func() {
+		rec, hooks := newRecorder()
+		store := cookie.NewMemoryStore()
+		store.SetHooks(hooks)
+		newCookie := cookie.New(store, cookie.IdleTimeout(time.Millisecond))
+
+		c, _ := newCookie(New(t), &http.Request{Header: make(http.Header)}, "demo")
+		c.SetValue("name", "demo")
+		c.Store()
+
+		time.Sleep(5 * time.Millisecond)
+		store.Purge()
+
+		So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventExpired})
+		So(rec.events[0].SessionID, ShouldEqual, c.GetSessionID())
+		So(rec.events[0].Request, ShouldBeNil)
+	})
+
+	Convey("Client cookies should fire the events of a session.", t, func() {
+		rec, hooks := newRecorder()
+		keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+		newCookie := cookie.NewClient(keys, cookie.SessionHooks(hooks))
+
+		c, _ := newCookie(New(t), &http.Request{Header: make(http.Header)}, "demo")
+		c.Store()
+
+		So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventCreated, cookie.EventSaved})
+
+		rec.events = nil
+		loaded, _ := newCookie(New(t), withCookie(c), "demo")
+		So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventLoaded})
+
+		rec.events = nil
+		oldID := loaded.GetSessionID()
+		So(loaded.Regenerate(New(t)), ShouldBeNil)
+		So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventSaved, cookie.EventRotated})
+		So(rec.events[1].OldID, ShouldEqual, oldID)
+
+		rec.events = nil
+		loaded.Remove(New(t))
+		So(rec.types(), ShouldResemble, []cookie.EventType{cookie.EventDestroyed})
+	})
+}
@@ -0,0 +1,231 @@
+package cookie
+
+import (
+	"errors"
+	"time"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+// Fields of a session that hold the user and the metadata of the session.
+const (
+	userField      = "_user"
+	lastSeenField  = "_last_seen"
+	ipField        = "_ip"
+	userAgentField = "_user_agent"
+)
+
+// ErrNoIndex is returned if sessions should be bound to a user, but the
+// backend can't find the sessions of a user.
+var ErrNoIndex = errors.New("store has no user index")
+
+// Indexer is implemented by stores that keep an index from a user to the IDs
+// of the sessions of the user. The index may contain IDs of sessions that are
+// expired or belong to another user by now, UserSessions removes them.
+type Indexer interface {
+	// Index adds a session to the sessions of a user.
+	Index(user, id string) error
+	// Unindex removes a session from the sessions of a user.
+	Unindex(user, id string) error
+	// Sessions returns the IDs of the sessions of a user.
+	Sessions(user string) ([]string, error)
+}
+
+// SessionInfo describes a session of a user. The ID is the session ID and
+// must not be shown to anyone but the owner of the session.
+type SessionInfo struct {
+	ID        string
+	User      string
+	Created   time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+}
+
+// GetUser returns the user the session belongs to. The result is empty if
+// SetUser wasn't called.
+func (session *StoreCookie) GetUser() string {
+	return string(session.GetValue(userField))
+}
+
+// SetUser binds the session to a user, so it shows up in UserSessions and can
+// be revoked. The store has to be an Indexer, otherwise ErrNoIndex is
+// returned. It should be called after Regenerate on login. An empty user
+// unbinds the session, e.g. on logout.
+func (session *StoreCookie) SetUser(user string) error {
+	indexer, ok := session.Backend.(Indexer)
+	if !ok {
+		return ErrNoIndex
+	}
+
+	old := session.GetUser()
+	if old == user {
+		return nil
+	}
+
+	if old != "" {
+		if err := indexer.Unindex(old, session.SessionID); err != nil {
+			return err
+		}
+	}
+
+	if user == "" {
+		return session.DeleteValue(userField)
+	}
+
+	session.create()
+	session.seen = true
+	session.SetValue(userField, []byte(user))
+
+	if err := indexer.Index(user, session.SessionID); err != nil {
+		return err
+	}
+
+	session.writeSeen()
+
+	return nil
+}
+
+// touch updates the metadata of a session that belongs to a user. It writes
+// at most once per request, and only if the last write is older than the
+// TouchInterval. New sessions don't belong to a user until SetUser is called.
+func (session *StoreCookie) touch() {
+	if session.seen {
+		return
+	}
+	session.seen = true
+
+	if session.isNew || session.GetUser() == "" {
+		return
+	}
+
+	lastSeen, err := session.getValue(lastSeenField)
+	if err == nil && time.Since(decodeTime(lastSeen)) < session.opts.touchInterval {
+		return
+	}
+
+	session.writeSeen()
+}
+
+// writeSeen writes the time, the IP and the user agent of the request to the
+// session.
+func (session *StoreCookie) writeSeen() {
+	values := map[string][]byte{
+		lastSeenField:  encodeTime(time.Now()),
+		ipField:        []byte(tools.GetIP(session.r)),
+		userAgentField: []byte(session.r.UserAgent()),
+	}
+
+	if session.opts.buffered {
+		for Name, value := range values {
+			session.buffer.set(Name, value)
+		}
+		return
+	}
+
+	applyBatch(session.Backend, session.SessionID, values, nil, 0)
+}
+
+// reindex moves the session in the user index from one ID to another.
+func (session *StoreCookie) reindex(user, id, newID string) error {
+	indexer, ok := session.Backend.(Indexer)
+	if !ok || user == "" {
+		return nil
+	}
+
+	if err := indexer.Unindex(user, id); err != nil {
+		return err
+	}
+
+	if newID == "" {
+		return nil
+	}
+
+	return indexer.Index(user, newID)
+}
+
+// UserSessions returns the active sessions of a user. IDs in the index that
+// don't belong to the user anymore are removed from the index. The store has
+// to be an Indexer, otherwise ErrNoIndex is returned.
+func UserSessions(store Store, user string) ([]SessionInfo, error) {
+	indexer, ok := store.(Indexer)
+	if !ok {
+		return nil, ErrNoIndex
+	}
+
+	ids, err := indexer.Sessions(user)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]SessionInfo, 0, len(ids))
+	for _, id := range ids {
+		values, err := store.GetAll(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if string(values[userField]) != user {
+			if err := indexer.Unindex(user, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		result = append(result, SessionInfo{
+			ID:        id,
+			User:      user,
+			Created:   decodeTime(values[createdField]),
+			LastSeen:  decodeTime(values[lastSeenField]),
+			IP:        string(values[ipField]),
+			UserAgent: string(values[userAgentField]),
+		})
+	}
+
+	return result, nil
+}
+
+// RevokeSession destroys a session of a user. The session is only destroyed
+// if it belongs to the given user. Revoking a session that doesn't exist is
+// not an error.
+func RevokeSession(store Store, user, id string) error {
+	indexer, ok := store.(Indexer)
+	if !ok {
+		return ErrNoIndex
+	}
+
+	value, err := store.Get(id, userField)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	if err == nil && string(value) == user {
+		if err := store.Destroy(id); err != nil {
+			return err
+		}
+	}
+
+	return indexer.Unindex(user, id)
+}
+
+// RevokeUserSessions destroys all sessions of a user, e.g. after the password
+// was changed.
+func RevokeUserSessions(store Store, user string) error {
+	indexer, ok := store.(Indexer)
+	if !ok {
+		return ErrNoIndex
+	}
+
+	ids, err := indexer.Sessions(user)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := RevokeSession(store, user, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package cookie_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUserSessions(t *testing.T) {
+	Convey("Sessions bound to a user should be listed and revoked.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour))
+
+		// login creates a session for the user
+		login := func(user, agent string) cookie.Cookie {
+			r := &http.Request{Header: make(http.Header), RemoteAddr: "10.0.0.1"}
+			r.Header.Set("User-Agent", agent)
+
+			c, err := newCookie(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(c.SetUser(user), ShouldBeNil)
+			c.Store()
+
+			return c
+		}
+
+		first := login("alice", "firefox")
+		second := login("alice", "curl")
+		login("bob", "chrome")
+
+		Convey("UserSessions should return the metadata of every session", func() {
+			sessions, err := cookie.UserSessions(store, "alice")
+			So(err, ShouldBeNil)
+			So(sessions, ShouldHaveLength, 2)
+
+			agents := map[string]string{}
+			for _, session := range sessions {
+				So(session.User, ShouldEqual, "alice")
+				So(session.IP, ShouldEqual, "10.0.0.1")
+				So(session.Created.IsZero(), ShouldBeFalse)
+				So(session.LastSeen.IsZero(), ShouldBeFalse)
+				agents[session.ID] = session.UserAgent
+			}
+
+			So(agents[first.GetSessionID()], ShouldEqual, "firefox")
+			So(agents[second.GetSessionID()], ShouldEqual, "curl")
+		})
+
+		Convey("RevokeSession should destroy a single session", func() {
+			So(cookie.RevokeSession(store, "alice", first.GetSessionID()), ShouldBeNil)
+
+			sessions, _ := cookie.UserSessions(store, "alice")
+			So(sessions, ShouldHaveLength, 1)
+			So(sessions[0].ID, ShouldEqual, second.GetSessionID())
+
+			httpCookie := first.GetCookie()
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&httpCookie)
+
+			c, _ := newCookie(New(t), r, "demo")
+			So(c.GetSessionID(), ShouldNotEqual, first.GetSessionID())
+			So(c.GetUser(), ShouldBeEmpty)
+		})
+
+		Convey("RevokeSession should not destroy sessions of other users", func() {
+			So(cookie.RevokeSession(store, "bob", first.GetSessionID()), ShouldBeNil)
+
+			user, _ := store.Get(first.GetSessionID(), "_user")
+			So(string(user), ShouldEqual, "alice")
+		})
+
+		Convey("RevokeUserSessions should destroy all sessions of a user", func() {
+			So(cookie.RevokeUserSessions(store, "alice"), ShouldBeNil)
+
+			sessions, _ := cookie.UserSessions(store, "alice")
+			So(sessions, ShouldBeEmpty)
+
+			sessions, _ = cookie.UserSessions(store, "bob")
+			So(sessions, ShouldHaveLength, 1)
+		})
+
+		Convey("Regenerate should keep the session in the index", func() {
+			So(first.Regenerate(New(t)), ShouldBeNil)
+
+			ids, _ := store.Sessions("alice")
+			So(ids, ShouldContain, first.GetSessionID())
+			So(ids, ShouldHaveLength, 2)
+		})
+
+		Convey("An empty user should unbind the session", func() {
+			So(first.SetUser(""), ShouldBeNil)
+			So(first.GetUser(), ShouldBeEmpty)
+
+			ids, _ := store.Sessions("alice")
+			So(ids, ShouldResemble, []string{second.GetSessionID()})
+
+			ids, _ = store.Sessions("")
+			So(ids, ShouldBeEmpty)
+
+			sessions, _ := cookie.UserSessions(store, "alice")
+			So(sessions, ShouldHaveLength, 1)
+		})
+
+		Convey("Remove should drop the session from the index", func() {
+			first.Remove(New(t))
+
+			ids, _ := store.Sessions("alice")
+			So(ids, ShouldResemble, []string{second.GetSessionID()})
+		})
+
+		Convey("Sessions that were destroyed elsewhere should be removed from the index", func() {
+			store.Destroy(second.GetSessionID())
+
+			sessions, _ := cookie.UserSessions(store, "alice")
+			So(sessions, ShouldHaveLength, 1)
+
+			ids, _ := store.Sessions("alice")
+			So(ids, ShouldResemble, []string{first.GetSessionID()})
+		})
+	})
+
+	Convey("Buffered sessions should be indexed when they are stored.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store, cookie.Buffered())
+
+		r := &http.Request{Header: make(http.Header), RemoteAddr: "10.0.0.2"}
+		c, _ := newCookie(New(t), r, "demo")
+		So(c.SetUser("alice"), ShouldBeNil)
+		c.Store()
+
+		sessions, err := cookie.UserSessions(store, "alice")
+		So(err, ShouldBeNil)
+		So(sessions, ShouldHaveLength, 1)
+		So(sessions[0].ID, ShouldEqual, c.GetSessionID())
+		So(sessions[0].IP, ShouldEqual, "10.0.0.2")
+	})
+
+	Convey("The metadata of a session should only be written once per interval.", t, func() {
+		store := &countingStore{cookie.NewMemoryStore(), make(map[string]int)}
+
+		// request loads the session of c, changes nothing and stores it
+		request := func(newCookie cookie.CookieFunc, c cookie.Cookie) {
+			httpCookie := c.GetCookie()
+			r := &http.Request{Header: make(http.Header), RemoteAddr: "10.0.0.3"}
+			r.AddCookie(&httpCookie)
+
+			next, err := newCookie(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(next.GetUser(), ShouldEqual, "alice")
+			next.Store()
+		}
+
+		// login binds a new session to the user and resets the counters
+		login := func(newCookie cookie.CookieFunc) cookie.Cookie {
+			c, _ := newCookie(New(t), &http.Request{Header: make(http.Header)}, "demo")
+			So(c.SetUser("alice"), ShouldBeNil)
+			c.Store()
+			store.calls = make(map[string]int)
+
+			return c
+		}
+
+		Convey("Unchanged buffered sessions should not be written", func() {
+			newCookie := cookie.New(store, cookie.Buffered())
+			c := login(newCookie)
+
+			for i := 0; i < 3; i++ {
+				request(newCookie, c)
+			}
+			So(store.calls["Apply"], ShouldEqual, 0)
+			So(store.calls["Set"], ShouldEqual, 0)
+		})
+
+		Convey("Unchanged sessions should not be written", func() {
+			newCookie := cookie.New(store)
+			c := login(newCookie)
+
+			for i := 0; i < 3; i++ {
+				request(newCookie, c)
+			}
+			So(store.calls["Apply"], ShouldEqual, 0)
+			So(store.calls["Set"], ShouldEqual, 0)
+		})
+
+		Convey("The metadata should be written again after the interval", func() {
+			newCookie := cookie.New(store, cookie.Buffered(), cookie.TouchInterval(20*time.Millisecond))
+			c := login(newCookie)
+
+			request(newCookie, c)
+			So(store.calls["Apply"], ShouldEqual, 0)
+
+			time.Sleep(30 * time.Millisecond)
+			request(newCookie, c)
+			So(store.calls["Apply"], ShouldEqual, 1)
+
+			sessions, _ := cookie.UserSessions(store, "alice")
+			So(sessions, ShouldHaveLength, 1)
+			So(sessions[0].IP, ShouldEqual, "10.0.0.3")
+		})
+	})
+
+	Convey("Cookies without an index should report ErrNoIndex.", t, func() {
+		keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+		c, _ := cookie.NewClient(keys)(New(t), &http.Request{}, "demo")
+
+		So(c.SetUser("alice"), ShouldEqual, cookie.ErrNoIndex)
+	})
+}
@@ -0,0 +1,367 @@
+package cookie
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps the sessions in the memory of the process.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]map[string][]byte
+	expires  map[string]time.Time
+	defaults map[string][]byte
+	users    map[string]map[string]bool
+	hooks    *Hooks
+}
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]map[string][]byte),
+		expires:  make(map[string]time.Time),
+		defaults: make(map[string][]byte),
+		users:    make(map[string]map[string]bool),
+	}
+}
+
+// Get returns the value of a field. Sessions that don't exist yet contain the
+// default values of the store.
+func (s *MemoryStore) Get(id, field string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := s.values(id)
+
+	value, ok := values[field]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return value, nil
+}
+
+// Set stores the value of a field. The session will be created if it doesn't
+// exist yet.
+func (s *MemoryStore) Set(id, field string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.open(id)[field] = value
+
+	return nil
+}
+
+// Delete removes a field from a session.
+func (s *MemoryStore) Delete(id, field string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.open(id), field)
+
+	return nil
+}
+
+// GetAll returns a copy of all fields of a session.
+func (s *MemoryStore) GetAll(id string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := s.values(id)
+
+	result := make(map[string][]byte, len(values))
+	for k, v := range values {
+		result[k] = v
+	}
+
+	return result, nil
+}
+
+// Expire sets the time to live of a session. A ttl of 0 or less makes the
+// session persistent.
+func (s *MemoryStore) Expire(id string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ttl <= 0 {
+		delete(s.expires, id)
+	} else if _, ok := s.sessions[id]; ok {
+		s.expires[id] = time.Now().Add(ttl)
+	}
+
+	return nil
+}
+
+// Rename moves all values of a session to a new ID. The time to live of the
+// session is kept.
+func (s *MemoryStore) Rename(id, newID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.expired(id) {
+		delete(s.sessions, id)
+		delete(s.expires, id)
+	}
+
+	values, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+
+	s.sessions[newID] = values
+	delete(s.sessions, id)
+
+	if expires, ok := s.expires[id]; ok {
+		s.expires[newID] = expires
+		delete(s.expires, id)
+	}
+
+	return nil
+}
+
+// Exists reports if a session exists. Unlike the other methods it doesn't see
+// the default values in sessions that don't exist.
+func (s *MemoryStore) Exists(id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.sessions[id]
+
+	return ok && !s.expired(id), nil
+}
+
+// Take returns the value of a field and deletes it.
+func (s *MemoryStore) Take(id, field string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values, ok := s.sessions[id]
+	if !ok || s.expired(id) {
+		return nil, ErrNotFound
+	}
+
+	value, ok := values[field]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(values, field)
+
+	return value, nil
+}
+
+// Apply sets and deletes the given fields of a session at once. A ttl greater
+// than 0 also sets the time to live of the session.
+func (s *MemoryStore) Apply(id string, set map[string][]byte, del []string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := s.open(id)
+	for k, v := range set {
+		values[k] = v
+	}
+
+	for _, k := range del {
+		delete(values, k)
+	}
+
+	if ttl > 0 {
+		s.expires[id] = time.Now().Add(ttl)
+	}
+
+	return nil
+}
+
+// Update replaces the value of a field with the result of f. f is called
+// without the lock, the value is only written if the field still has the old
+// value afterwards.
+func (s *MemoryStore) Update(id, field string, f func(old []byte) ([]byte, error)) error {
+	for i := 0; i < updateAttempts; i++ {
+		backoff(i)
+
+		old, err := s.Get(id, field)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		found := err == nil
+
+		value, err := f(old)
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		current, ok := s.values(id)[field]
+		if ok == found && bytes.Equal(current, old) {
+			s.open(id)[field] = value
+			s.mu.Unlock()
+			return nil
+		}
+		s.mu.Unlock()
+	}
+
+	return ErrConflict
+}
+
+// Destroy removes a session and all of it's values.
+func (s *MemoryStore) Destroy(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	delete(s.expires, id)
+
+	return nil
+}
+
+// Purge removes all expired sessions. Expired sessions are not visible, but
+// they only free their memory when they are accessed or purged. EventExpired
+// is fired for every purged session.
+func (s *MemoryStore) Purge() {
+	s.mu.Lock()
+
+	var purged []string
+	for id := range s.expires {
+		if s.expired(id) {
+			if user, ok := s.sessions[id][userField]; ok {
+				delete(s.users[string(user)], id)
+			}
+			delete(s.sessions, id)
+			delete(s.expires, id)
+			purged = append(purged, id)
+		}
+	}
+
+	hooks := s.hooks
+	s.mu.Unlock()
+
+	// The hooks may use the store, so they are called without the lock
+	for _, id := range purged {
+		hooks.Fire(Event{Type: EventExpired, SessionID: id})
+	}
+}
+
+// SetHooks sets the registry that receives EventExpired when Purge removes
+// a session.
+func (s *MemoryStore) SetHooks(h *Hooks) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks = h
+}
+
+// Index adds a session to the sessions of a user.
+func (s *MemoryStore) Index(user, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, ok := s.users[user]
+	if !ok {
+		ids = make(map[string]bool)
+		s.users[user] = ids
+	}
+	ids[id] = true
+
+	return nil
+}
+
+// Unindex removes a session from the sessions of a user.
+func (s *MemoryStore) Unindex(user, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users[user], id)
+	if len(s.users[user]) == 0 {
+		delete(s.users, user)
+	}
+
+	return nil
+}
+
+// Sessions returns the sorted IDs of the sessions of a user.
+func (s *MemoryStore) Sessions(user string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]string, 0, len(s.users[user]))
+	for id := range s.users[user] {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// expired reports if the time to live of a session is over. The caller must
+// hold the lock.
+func (s *MemoryStore) expired(id string) bool {
+	expires, ok := s.expires[id]
+
+	return ok && time.Now().After(expires)
+}
+
+// values returns the values of a session. Unknown and expired sessions return
+// the default values. The caller must hold the lock.
+func (s *MemoryStore) values(id string) map[string][]byte {
+	values, ok := s.sessions[id]
+	if !ok || s.expired(id) {
+		return s.defaults
+	}
+
+	return values
+}
+
+// open returns the values of a session. Unknown sessions are created using the
+// default values. The caller must hold the write lock.
+func (s *MemoryStore) open(id string) map[string][]byte {
+	if s.expired(id) {
+		delete(s.sessions, id)
+		delete(s.expires, id)
+	}
+
+	values, ok := s.sessions[id]
+	if !ok {
+		values = make(map[string][]byte, len(s.defaults))
+		for k, v := range s.defaults {
+			values[k] = v
+		}
+		s.sessions[id] = values
+	}
+
+	return values
+}
+
+// MemoryCookie is a session that keeps it's values in a MemoryStore. It is
+// meant for development servers and tests that should run without a Redis
+// instance.
+type MemoryCookie struct {
+	*StoreCookie
+}
+
+// NewMemory creates a new MemoryStore and returns a CookieFunc that creates the
+// sessions of the store. Every new session starts with a copy of the given
+// Values.
+func NewMemory(Values map[string]interface{}, opts ...Option) CookieFunc {
+	store := NewMemoryStore()
+	codec := newOptions(opts).codec
+
+	for k, v := range Values {
+		data, err := encodeValue(codec, v)
+		if err != nil {
+			continue
+		}
+		store.defaults[k] = data
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, Name string) (Cookie, error) {
+		session, err := NewStoreCookie(w, r, Name, store, opts...)
+		if err != nil {
+			return &MemoryCookie{}, err
+		}
+
+		return &MemoryCookie{session}, nil
+	}
+}
@@ -0,0 +1,18 @@
+// Package msgpack encodes the values of sessions as MessagePack. It is a
+// separate package, so only users of the codec depend on the library.
+package msgpack
+
+import "github.com/vmihailenco/msgpack"
+
+// Codec encodes values as MessagePack. It implements cookie.Codec.
+type Codec struct{}
+
+// Marshal encodes a value as MessagePack.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal decodes a MessagePack value.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
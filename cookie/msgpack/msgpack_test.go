@@ -0,0 +1,75 @@
+package msgpack_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/anihex/server-utils/cookie/msgpack"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type user struct {
+	Name  string
+	Roles []string
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+	backends := map[string]cookie.CookieFunc{
+		"memory":   cookie.NewMemory(nil, cookie.ValueCodec(msgpack.Codec{})),
+		"buffered": cookie.NewMemory(nil, cookie.ValueCodec(msgpack.Codec{}), cookie.Buffered()),
+		"client":   cookie.NewClient(keys, cookie.ValueCodec(msgpack.Codec{})),
+	}
+
+	created := time.Unix(1500000000, 123456789)
+
+	for backend, newCookie := range backends {
+		Convey("The msgpack codec should round-trip the values of the "+backend+" cookie.", t, func() {
+			w := httptest.NewRecorder()
+			c, err := newCookie(w, &http.Request{}, "demo")
+			So(err, ShouldBeNil)
+
+			c.SetValue("uint", uint64(5))
+			c.SetValue("int", int64(-5))
+			c.SetValue("string", "demo")
+			c.SetValue("bool", true)
+			c.SetValue("float", 1.5)
+			c.SetValue("time", created)
+			c.SetValue("duration", time.Minute)
+			c.SetValue("strings", []string{"a", "b"})
+			So(c.SetInterface("user", user{"demo", []string{"admin"}}), ShouldBeNil)
+			c.Store()
+
+			r := &http.Request{Header: make(http.Header)}
+			for _, httpCookie := range w.Result().Cookies() {
+				r.AddCookie(httpCookie)
+			}
+
+			next, err := newCookie(httptest.NewRecorder(), r, "demo")
+			So(err, ShouldBeNil)
+			So(next.GetSessionID(), ShouldEqual, c.GetSessionID())
+			So(next.GetUint64("uint"), ShouldEqual, 5)
+			So(next.GetInt64("int"), ShouldEqual, -5)
+			So(next.GetString("string"), ShouldEqual, "demo")
+			So(next.GetBool("bool"), ShouldBeTrue)
+			So(next.GetFloat64("float"), ShouldEqual, 1.5)
+			So(next.GetTime("time").Equal(created), ShouldBeTrue)
+			So(next.GetDuration("duration"), ShouldEqual, time.Minute)
+			So(next.GetStringArray("strings"), ShouldResemble, []string{"a", "b"})
+
+			var result user
+			So(next.GetInterface("user", &result), ShouldBeNil)
+			So(result, ShouldResemble, user{"demo", []string{"admin"}})
+
+			Convey("Invalid values should return an error", func() {
+				_, found, err := next.LookupBool("string")
+				So(found, ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// +build redis
+
+package cookie
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ListenExpired fires EventExpired for every session of the store that expires
+// in Redis. It uses keyspace notifications, which have to be enabled on the
+// server with "notify-keyspace-events Ex". In a cluster every node is
+// subscribed. It blocks until the context is done or a connection fails.
+// The store needs a Prefix to tell its sessions apart from other keys,
+// otherwise ErrNoPrefix is returned.
+func (s *RedisStore) ListenExpired(ctx context.Context, hooks *Hooks, db int) error {
+	if s.Prefix == "" {
+		return ErrNoPrefix
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conns := s.masters()
+	errs := make(chan error, len(conns))
+
+	for _, conn := range conns {
+		go func(conn redis.Conn) {
+			err := s.listen(ctx, conn, hooks, db)
+
+			// One failed connection stops the others
+			cancel()
+			errs <- err
+		}(conn)
+	}
+
+	var result error
+	for range conns {
+		if err := <-errs; err != nil && (result == nil || result == context.Canceled) {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// listen receives the expired events of a single server until the context is
+// done.
+func (s *RedisStore) listen(ctx context.Context, conn redis.Conn, hooks *Hooks, db int) error {
+	// Subscriptions aren't redirected, so the node is used directly
+	if c, ok := conn.(*clusterConn); ok {
+		conn = c.Conn
+	}
+
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if err := psc.Subscribe("__keyevent@" + strconv.Itoa(db) + "__:expired"); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	defer wg.Wait()
+	defer close(done)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		select {
+		case <-ctx.Done():
+			psc.Unsubscribe()
+		case <-done:
+		}
+	}()
+
+	for {
+		// Without a timeout the read timeout of the pool would end the loop
+		switch v := psc.ReceiveWithTimeout(0).(type) {
+		case redis.Message:
+			s.expired(hooks, string(v.Data))
+		case redis.Subscription:
+			if v.Count == 0 {
+				return ctx.Err()
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+// expired fires EventExpired if the key belongs to a session of the store.
+func (s *RedisStore) expired(hooks *Hooks, key string) {
+	if !strings.HasPrefix(key, s.Prefix) {
+		return
+	}
+
+	id := strings.TrimPrefix(key, s.Prefix)
+	if id == "" || strings.Contains(id, ":") {
+		return
+	}
+
+	hooks.Fire(Event{Type: EventExpired, SessionID: id})
+}
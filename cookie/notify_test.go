@@ -0,0 +1,92 @@
+// +build redis
+
+package cookie_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const expiredChannel = "__keyevent@0__:expired"
+
+// listen starts ListenExpired and waits until the servers are subscribed. It
+// returns the expired session IDs, the result of ListenExpired and a function
+// that stops it.
+func listen(store *cookie.RedisStore, servers ...*fakeServer) (<-chan string, <-chan error, func()) {
+	expired := make(chan string, 10)
+	hooks := cookie.NewHooks()
+	hooks.On(func(e cookie.Event) { expired <- e.SessionID }, cookie.EventExpired)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- store.ListenExpired(ctx, hooks, 0) }()
+
+	for _, server := range servers {
+		for server.subscribers(expiredChannel) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	return expired, result, cancel
+}
+
+func TestListenExpired(t *testing.T) {
+	Convey("ListenExpired should report the sessions that expire in Redis.", t, func() {
+		server := newFakeServer("127.0.0.1:6379")
+		dial := fakeDialer(server)
+		pool := &redis.Pool{Dial: func() (redis.Conn, error) { return dial(server.addr) }}
+
+		store := cookie.NewRedisStore(pool)
+		store.Prefix = cookie.KeyPrefix("app", "demo")
+
+		expired, result, cancel := listen(store, server)
+
+		server.expire(store.Prefix + "sessions:alice")
+		server.expire("app:other:0123456789")
+		server.expire(store.Prefix + "0123456789")
+
+		So(<-expired, ShouldEqual, "0123456789")
+
+		cancel()
+		So(<-result, ShouldEqual, context.Canceled)
+		So(expired, ShouldBeEmpty)
+		So(server.subscribers(expiredChannel), ShouldEqual, 0)
+	})
+
+	Convey("ListenExpired should subscribe to every node of a cluster.", t, func() {
+		cluster := &fakeCluster{split: 8192, nodes: [2]string{"10.0.1.1:7000", "10.0.1.2:7000"}}
+		first := newFakeServer(cluster.nodes[0])
+		second := newFakeServer(cluster.nodes[1])
+		first.cluster, second.cluster = cluster, cluster
+
+		provider := cookie.NewClusterProvider([]string{first.addr}, fakeDialer(first, second))
+		store := cookie.NewRedisProviderStore(provider)
+		store.Prefix = cookie.KeyPrefix("app", "demo")
+
+		expired, result, cancel := listen(store, first, second)
+
+		first.expire(store.Prefix + "first")
+		So(<-expired, ShouldEqual, "first")
+		second.expire(store.Prefix + "second")
+		So(<-expired, ShouldEqual, "second")
+
+		cancel()
+		So(<-result, ShouldEqual, context.Canceled)
+	})
+
+	Convey("ListenExpired should refuse a store without a prefix.", t, func() {
+		server := newFakeServer("127.0.0.1:6379")
+		dial := fakeDialer(server)
+		pool := &redis.Pool{Dial: func() (redis.Conn, error) { return dial(server.addr) }}
+
+		err := cookie.NewRedisStore(pool).ListenExpired(context.Background(), cookie.NewHooks(), 0)
+		So(err, ShouldEqual, cookie.ErrNoPrefix)
+		So(server.subscribers(expiredChannel), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,291 @@
+package cookie
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+// idLength is the length of a session ID.
+const idLength = 32
+
+// defaultTouchInterval is the time after which the metadata of a session
+// that belongs to a user is written again.
+const defaultTouchInterval = time.Minute
+
+// defaultLifetime is the time the client keeps the cookie if nothing else is
+// configured.
+const defaultLifetime = 10 * 365 * 24 * time.Hour
+
+// Cookie name prefixes that make browsers enforce the attributes of a cookie.
+const (
+	hostPrefix   = "__Host-"
+	securePrefix = "__Secure-"
+)
+
+// options holds the settings of the cookies created by a constructor.
+type options struct {
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	generator       func(int) string
+	path            string
+	domain          string
+	secure          bool
+	sameSite        http.SameSite
+	lifetime        time.Duration
+	maxAge          time.Duration
+	prefix          string
+	buffered        bool
+	touchInterval   time.Duration
+	namespace       string
+	codec           Codec
+	hooks           *Hooks
+	fingerprints    map[string]*FingerprintPolicy
+}
+
+// Option configures the cookies created by a constructor.
+type Option func(*options)
+
+// newOptions applies the given Options to the default settings.
+func newOptions(opts []Option) options {
+	result := options{
+		generator:     tools.SecureGID,
+		path:          "/",
+		lifetime:      defaultLifetime,
+		touchInterval: defaultTouchInterval,
+		codec:         JSONCodec{},
+	}
+
+	for _, opt := range opts {
+		opt(&result)
+	}
+
+	// Browsers reject prefixed cookies that don't have these attributes
+	switch result.prefix {
+	case hostPrefix:
+		result.secure = true
+		result.path = "/"
+		result.domain = ""
+	case securePrefix:
+		result.secure = true
+	}
+
+	return result
+}
+
+// cookieName returns the name of the http cookie.
+func (o options) cookieName(Name string) string {
+	return o.prefix + Name
+}
+
+// httpCookie creates the http cookie that carries the value to the client.
+// The cookie doesn't outlive the absolute timeout of a session created at the
+// given time.
+func (o options) httpCookie(Name, value string, created time.Time) http.Cookie {
+	c := http.Cookie{
+		Name:     Name,
+		Value:    value,
+		Path:     o.path,
+		Domain:   o.domain,
+		Secure:   o.secure,
+		HttpOnly: true,
+		SameSite: o.sameSite,
+	}
+
+	lifetime := o.lifetime
+	if o.maxAge > 0 {
+		lifetime = o.maxAge
+	}
+
+	if o.absoluteTimeout > 0 {
+		left := time.Until(created.Add(o.absoluteTimeout))
+		if lifetime <= 0 || left < lifetime {
+			lifetime = left
+		}
+	}
+
+	if lifetime <= 0 {
+		return c
+	}
+
+	if o.maxAge > 0 {
+		c.MaxAge = int(lifetime / time.Second)
+	} else {
+		c.Expires = time.Now().Add(lifetime)
+	}
+
+	return c
+}
+
+// expiredCookie creates a http cookie that makes the client delete the cookie.
+func (o options) expiredCookie(Name string) http.Cookie {
+	c := o.httpCookie(Name, "", time.Now())
+	c.Expires = time.Unix(0, 0)
+	c.MaxAge = -1
+
+	return c
+}
+
+// keyPrefix returns the prefix of the store keys of the cookie with the given
+// name.
+func (o options) keyPrefix(Name string) string {
+	if o.namespace == "" {
+		return ""
+	}
+
+	return KeyPrefix(o.namespace, Name)
+}
+
+// expires reports if sessions have a limited lifetime on the server side.
+func (o options) expires() bool {
+	return o.idleTimeout > 0 || o.absoluteTimeout > 0
+}
+
+// IdleTimeout sets the time after which an unused session expires. Every
+// access to the session restarts the timeout.
+func IdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// AbsoluteTimeout sets the time after which a session expires, no matter how
+// often it was used.
+func AbsoluteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.absoluteTimeout = d
+	}
+}
+
+// IDGenerator sets the function that creates new session IDs. It receives the
+// length of the ID. The default is tools.SecureGID. tools.GID is predictable
+// and should only be used for tests. IDs have to be exactly 32 characters
+// long and may only contain the characters of tools.GID (a-z, A-Z, 0-9, '-'
+// and '_'). Store based cookies return ErrInvalidID for other IDs, so UUIDs
+// can't be used.
+func IDGenerator(f func(int) string) Option {
+	return func(o *options) {
+		o.generator = f
+	}
+}
+
+// Path sets the path of the http cookie. The default is "/".
+func Path(path string) Option {
+	return func(o *options) {
+		o.path = path
+	}
+}
+
+// Domain sets the domain of the http cookie. By default the cookie is only
+// sent to the host that set it.
+func Domain(domain string) Option {
+	return func(o *options) {
+		o.domain = domain
+	}
+}
+
+// Secure makes the client send the http cookie over HTTPS only.
+func Secure(secure bool) Option {
+	return func(o *options) {
+		o.secure = secure
+	}
+}
+
+// SameSite sets the SameSite attribute of the http cookie.
+func SameSite(mode http.SameSite) Option {
+	return func(o *options) {
+		o.sameSite = mode
+	}
+}
+
+// Expires sets how long the client keeps the http cookie using the Expires
+// attribute. The default is 10 years. A duration of 0 creates a cookie that
+// is deleted when the browser is closed.
+func Expires(d time.Duration) Option {
+	return func(o *options) {
+		o.lifetime = d
+		o.maxAge = 0
+	}
+}
+
+// MaxAge sets how long the client keeps the http cookie using the Max-Age
+// attribute instead of Expires.
+func MaxAge(d time.Duration) Option {
+	return func(o *options) {
+		o.maxAge = d
+		o.lifetime = 0
+	}
+}
+
+// HostPrefix adds the "__Host-" prefix to the name of the http cookie. Browsers
+// only accept such cookies if they are secure, have the path "/" and no domain,
+// so these attributes are enforced.
+func HostPrefix() Option {
+	return func(o *options) {
+		o.prefix = hostPrefix
+	}
+}
+
+// SecurePrefix adds the "__Secure-" prefix to the name of the http cookie.
+// Browsers only accept such cookies if they are secure, so the Secure
+// attribute is enforced.
+func SecurePrefix() Option {
+	return func(o *options) {
+		o.prefix = securePrefix
+	}
+}
+
+// Buffered makes the sessions of a store based cookie buffer all changes. The
+// values are loaded with a single call when the first value is read and all
+// changes are written when Store is called. Store has to be called at the end
+// of every request, otherwise changes are lost.
+func Buffered() Option {
+	return func(o *options) {
+		o.buffered = true
+	}
+}
+
+// TouchInterval sets how often the last request, the IP and the user agent of
+// a session that belongs to a user are written. Requests within the interval
+// don't write the metadata, so unchanged buffered sessions cause no writes.
+// The default is one minute, 0 writes the metadata on every request.
+func TouchInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.touchInterval = d
+	}
+}
+
+// ValueCodec sets the codec that encodes the values of the sessions. The
+// default is JSONCodec. All cookies of a store have to use the same codec.
+func ValueCodec(c Codec) Option {
+	return func(o *options) {
+		o.codec = c
+	}
+}
+
+// SessionHooks sets the registry of hooks that receive the events of the
+// sessions.
+func SessionHooks(h *Hooks) Option {
+	return func(o *options) {
+		o.hooks = h
+	}
+}
+
+// Namespace puts the namespace and the name of the cookie in front of the
+// Redis keys of the sessions. Several applications and cookies can share a
+// Redis database this way. Existing sessions can be moved into the namespace
+// with RedisStore.Migrate. The store has to be a Namespacer, otherwise the
+// cookie returns ErrNoNamespace.
+func Namespace(ns string) Option {
+	return func(o *options) {
+		o.namespace = ns
+	}
+}
+
+// KeyPrefix returns the prefix of the Redis keys of the sessions of a cookie
+// in the given namespace. It is meant for stores that are used outside of a
+// request, e.g. to list or purge the sessions.
+func KeyPrefix(namespace, Name string) string {
+	return namespace + ":" + Name + ":"
+}
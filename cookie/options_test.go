@@ -0,0 +1,105 @@
+package cookie_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCookieAttributes(t *testing.T) {
+	Convey("The attributes of the http cookie should be configurable.", t, func() {
+		store := cookie.NewMemoryStore()
+
+		Convey("The defaults should match the previous behaviour", func() {
+			w := New(t)
+			tmpCookie, _ := cookie.New(store)(w, &http.Request{}, "demo")
+			tmpCookie.Store()
+
+			c := tmpCookie.GetCookie()
+			So(c.Path, ShouldEqual, "/")
+			So(c.HttpOnly, ShouldBeTrue)
+			So(c.Secure, ShouldBeFalse)
+			So(c.Expires, ShouldHappenAfter, time.Now().Add(9*365*24*time.Hour))
+		})
+
+		Convey("All attributes should be applied on creation, SetSessionID and Remove", func() {
+			newCookie := cookie.New(
+				store,
+				cookie.Secure(true),
+				cookie.SameSite(http.SameSiteStrictMode),
+				cookie.Domain("example.com"),
+				cookie.Path("/app"),
+				cookie.MaxAge(time.Hour),
+			)
+
+			w := New(t)
+			tmpCookie, _ := newCookie(w, &http.Request{}, "demo")
+			tmpCookie.SetValue("name", "demo")
+			tmpCookie.Store()
+			So(tmpCookie.SetSessionID(w, strings.Repeat("o", 32)), ShouldBeNil)
+			tmpCookie.Remove(w)
+
+			headers := w.Header()["Set-Cookie"]
+			So(len(headers), ShouldEqual, 3)
+			for _, header := range headers {
+				So(header, ShouldContainSubstring, "Path=/app")
+				So(header, ShouldContainSubstring, "Domain=example.com")
+				So(header, ShouldContainSubstring, "Secure")
+				So(header, ShouldContainSubstring, "HttpOnly")
+				So(header, ShouldContainSubstring, "SameSite=Strict")
+			}
+
+			So(headers[0], ShouldContainSubstring, "Max-Age=3600")
+			So(headers[0], ShouldNotContainSubstring, "Expires")
+			So(headers[1], ShouldStartWith, "demo="+strings.Repeat("o", 32)+";")
+			So(headers[2], ShouldContainSubstring, "Max-Age=0")
+		})
+
+		Convey("Loaded sessions should use the configured attributes as well", func() {
+			created, _ := cookie.New(store)(New(t), &http.Request{}, "demo")
+			created.SetValue("name", "demo")
+			created.Store()
+
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&http.Cookie{Name: "demo", Value: created.GetSessionID()})
+
+			tmpCookie, _ := cookie.New(store, cookie.Secure(true), cookie.Path("/app"))(New(t), r, "demo")
+			So(tmpCookie.GetSessionID(), ShouldEqual, created.GetSessionID())
+			So(tmpCookie.GetCookie().Secure, ShouldBeTrue)
+			So(tmpCookie.GetCookie().Path, ShouldEqual, "/app")
+		})
+
+		Convey("The __Host- prefix should enforce it's attributes", func() {
+			w := New(t)
+			tmpCookie, _ := cookie.New(store, cookie.HostPrefix(), cookie.Domain("example.com"), cookie.Path("/app"))(w, &http.Request{}, "demo")
+			tmpCookie.SetValue("name", "demo")
+			tmpCookie.Store()
+
+			c := tmpCookie.GetCookie()
+			So(c.Name, ShouldEqual, "__Host-demo")
+			So(c.Secure, ShouldBeTrue)
+			So(c.Path, ShouldEqual, "/")
+			So(c.Domain, ShouldEqual, "")
+
+			Convey("And the prefixed cookie should be read on the next request", func() {
+				r := &http.Request{Header: make(http.Header)}
+				r.AddCookie(&c)
+				nextCookie, _ := cookie.New(store, cookie.HostPrefix())(New(t), r, "demo")
+				So(nextCookie.GetSessionID(), ShouldEqual, tmpCookie.GetSessionID())
+			})
+		})
+
+		Convey("The __Secure- prefix should enforce the Secure attribute", func() {
+			tmpCookie, _ := cookie.New(store, cookie.SecurePrefix())(New(t), &http.Request{}, "demo")
+
+			c := tmpCookie.GetCookie()
+			So(c.Name, ShouldEqual, "__Secure-demo")
+			So(c.Secure, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,448 @@
+// +build redis
+
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// slotCount is the number of hash slots of a Redis Cluster.
+const slotCount = 16384
+
+// Provider returns the connections of a RedisStore. It decides which server
+// holds a key, so a store can be used with a single server, a master that is
+// discovered by Sentinel or a cluster.
+type Provider interface {
+	// Get returns a connection to the server that holds the given key. The
+	// caller has to close the connection.
+	Get(key string) redis.Conn
+}
+
+// dialTCP connects to a Redis server using TCP.
+func dialTCP(addr string) (redis.Conn, error) {
+	return redis.Dial("tcp", addr,
+		redis.DialConnectTimeout(5*time.Second),
+		redis.DialReadTimeout(5*time.Second),
+		redis.DialWriteTimeout(5*time.Second),
+	)
+}
+
+// newPool creates a pool that uses the given function to connect.
+func newPool(dial func() (redis.Conn, error)) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 4 * time.Minute,
+		Dial:        dial,
+	}
+}
+
+// PoolProvider returns the connections of a single pool for every key.
+type PoolProvider struct {
+	Pool *redis.Pool
+}
+
+// Get returns a connection of the pool.
+func (p *PoolProvider) Get(key string) redis.Conn {
+	return p.Pool.Get()
+}
+
+// SentinelProvider returns connections to the master that is monitored by
+// Redis Sentinel. The master is discovered when a connection is created, and
+// idle connections are checked before they are used, so a failover only
+// breaks the requests that are running while it happens.
+type SentinelProvider struct {
+	MasterName string
+	Sentinels  []string
+	Pool       *redis.Pool
+	dial       func(string) (redis.Conn, error)
+	mu         sync.Mutex
+}
+
+// NewSentinelProvider creates a provider for the master with the given name.
+// The Sentinels are asked in order. Dial connects to a sentinel or a server,
+// if it is nil a TCP connection is used.
+func NewSentinelProvider(MasterName string, Sentinels []string, Dial func(addr string) (redis.Conn, error)) *SentinelProvider {
+	if Dial == nil {
+		Dial = dialTCP
+	}
+
+	p := &SentinelProvider{
+		MasterName: MasterName,
+		Sentinels:  append([]string(nil), Sentinels...),
+		dial:       Dial,
+	}
+
+	p.Pool = newPool(p.dialMaster)
+	p.Pool.TestOnBorrow = func(c redis.Conn, t time.Time) error {
+		if time.Since(t) < time.Second {
+			return nil
+		}
+
+		return checkMaster(c)
+	}
+
+	return p
+}
+
+// Get returns a connection to the current master.
+func (p *SentinelProvider) Get(key string) redis.Conn {
+	return p.Pool.Get()
+}
+
+// MasterAddr asks the sentinels for the address of the master. The first
+// sentinel that answers is asked first the next time.
+func (p *SentinelProvider) MasterAddr() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var lastErr error
+	for i, sentinel := range p.Sentinels {
+		addr, err := p.askSentinel(sentinel)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		p.Sentinels[0], p.Sentinels[i] = p.Sentinels[i], p.Sentinels[0]
+
+		return addr, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no sentinels configured")
+	}
+
+	return "", fmt.Errorf("cookie: can't find master %s: %v", p.MasterName, lastErr)
+}
+
+// askSentinel asks a single sentinel for the address of the master.
+func (p *SentinelProvider) askSentinel(sentinel string) (string, error) {
+	conn, err := p.dial(sentinel)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", p.MasterName))
+	if err != nil {
+		return "", err
+	}
+
+	if len(reply) != 2 {
+		return "", errors.New("unknown master")
+	}
+
+	return net.JoinHostPort(reply[0], reply[1]), nil
+}
+
+// dialMaster connects to the current master.
+func (p *SentinelProvider) dialMaster() (redis.Conn, error) {
+	addr, err := p.MasterAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMaster(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// checkMaster returns an error if the server isn't a master (anymore).
+func checkMaster(conn redis.Conn) error {
+	reply, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+
+	if len(reply) == 0 {
+		return errors.New("cookie: invalid ROLE reply")
+	}
+
+	role, err := redis.String(reply[0], nil)
+	if err != nil {
+		return err
+	}
+
+	if role != "master" {
+		return fmt.Errorf("cookie: server is a %s", role)
+	}
+
+	return nil
+}
+
+// ClusterProvider returns connections to the node of a Redis Cluster that
+// serves the slot of a key. A session is a single hash, so all of it's fields
+// live on one slot. The slots are loaded with CLUSTER SLOTS and reloaded when
+// a node answers with a MOVED redirection.
+type ClusterProvider struct {
+	Nodes []string
+	dial  func(string) (redis.Conn, error)
+	mu    sync.RWMutex
+	slots []string
+	pools map[string]*redis.Pool
+}
+
+// NewClusterProvider creates a provider for the cluster that contains the
+// given Nodes. Dial connects to a node, if it is nil a TCP connection is used.
+func NewClusterProvider(Nodes []string, Dial func(addr string) (redis.Conn, error)) *ClusterProvider {
+	if Dial == nil {
+		Dial = dialTCP
+	}
+
+	return &ClusterProvider{
+		Nodes: append([]string(nil), Nodes...),
+		dial:  Dial,
+		pools: make(map[string]*redis.Pool),
+	}
+}
+
+// Get returns a connection to the node that serves the slot of the key. If
+// the slots can't be loaded, the first node is used.
+func (p *ClusterProvider) Get(key string) redis.Conn {
+	p.load()
+
+	return &clusterConn{Conn: p.conn(p.addr(HashSlot(key))), provider: p}
+}
+
+// Masters returns a connection to every node that serves slots. The caller has
+// to close the connections.
+func (p *ClusterProvider) Masters() []redis.Conn {
+	p.load()
+
+	p.mu.RLock()
+	addrs := make(map[string]bool)
+	for _, addr := range p.slots {
+		if addr != "" {
+			addrs[addr] = true
+		}
+	}
+	p.mu.RUnlock()
+
+	if len(addrs) == 0 && len(p.Nodes) > 0 {
+		addrs[p.Nodes[0]] = true
+	}
+
+	result := make([]redis.Conn, 0, len(addrs))
+	for addr := range addrs {
+		result = append(result, &clusterConn{Conn: p.conn(addr), provider: p})
+	}
+
+	return result
+}
+
+// load loads the slots if they weren't loaded yet.
+func (p *ClusterProvider) load() {
+	p.mu.RLock()
+	loaded := p.slots != nil
+	p.mu.RUnlock()
+
+	if !loaded {
+		p.Refresh()
+	}
+}
+
+// addr returns the address of the node that serves a slot.
+func (p *ClusterProvider) addr(slot int) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.slots != nil && p.slots[slot] != "" {
+		return p.slots[slot]
+	}
+
+	if len(p.Nodes) == 0 {
+		return ""
+	}
+
+	return p.Nodes[0]
+}
+
+// conn returns a connection of the pool of a node.
+func (p *ClusterProvider) conn(addr string) redis.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pool, ok := p.pools[addr]
+	if !ok {
+		pool = newPool(func() (redis.Conn, error) {
+			return p.dial(addr)
+		})
+		p.pools[addr] = pool
+	}
+
+	return pool.Get()
+}
+
+// Refresh loads the slots of the cluster from the first node that answers.
+func (p *ClusterProvider) Refresh() error {
+	var lastErr error
+	for _, addr := range p.Nodes {
+		conn := p.conn(addr)
+		slots, err := clusterSlots(conn)
+		conn.Close()
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		p.mu.Lock()
+		p.slots = slots
+		p.mu.Unlock()
+
+		return nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no nodes configured")
+	}
+
+	return fmt.Errorf("cookie: can't load cluster slots: %v", lastErr)
+}
+
+// clusterSlots reads the address of the master of every slot.
+func clusterSlots(conn redis.Conn) ([]string, error) {
+	ranges, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, slotCount)
+	for _, r := range ranges {
+		values, err := redis.Values(r, nil)
+		if err != nil || len(values) < 3 {
+			return nil, errors.New("invalid CLUSTER SLOTS reply")
+		}
+
+		start, err := redis.Int(values[0], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := redis.Int(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		master, err := redis.Values(values[2], nil)
+		if err != nil || len(master) < 2 {
+			return nil, errors.New("invalid CLUSTER SLOTS reply")
+		}
+
+		host, err := redis.String(master[0], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		port, err := redis.Int(master[1], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end && slot < slotCount; slot++ {
+			result[slot] = addr
+		}
+	}
+
+	return result, nil
+}
+
+// clusterConn follows the redirections of a cluster. Single commands are sent
+// again to the node that serves the slot. Pipelines and transactions can't be
+// repeated, they return the error after the slots were reloaded.
+type clusterConn struct {
+	redis.Conn
+	provider *ClusterProvider
+	pending  int
+}
+
+// Send counts the pending commands and sends the command.
+func (c *clusterConn) Send(cmd string, args ...interface{}) error {
+	c.pending++
+	return c.Conn.Send(cmd, args...)
+}
+
+// Do sends the command and follows MOVED and ASK redirections.
+func (c *clusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	pending := c.pending
+	c.pending = 0
+
+	reply, err := c.Conn.Do(cmd, args...)
+
+	redirect, ok := err.(redis.Error)
+	if !ok {
+		return reply, err
+	}
+
+	fields := strings.Fields(redirect.Error())
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return reply, err
+	}
+
+	if fields[0] == "MOVED" {
+		c.provider.Refresh()
+	}
+
+	if pending > 0 {
+		return reply, err
+	}
+
+	conn := c.provider.conn(fields[2])
+	defer conn.Close()
+
+	if fields[0] == "ASK" {
+		if _, err := conn.Do("ASKING"); err != nil {
+			return nil, err
+		}
+	}
+
+	return conn.Do(cmd, args...)
+}
+
+// HashSlot returns the cluster slot of a key. If the key contains a hash tag
+// like "{user}", only the tag is hashed, so keys with the same tag live on the
+// same slot.
+func HashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key)) % slotCount
+}
+
+// crc16 calculates the CRC16-CCITT (XMODEM) checksum that is used by Redis
+// Cluster.
+func crc16(data string) uint16 {
+	var crc uint16
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
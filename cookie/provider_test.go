@@ -0,0 +1,665 @@
+// +build redis
+
+package cookie_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeCluster maps the slots of a cluster to the address of a node.
+type fakeCluster struct {
+	mu    sync.Mutex
+	split int
+	nodes [2]string
+}
+
+// owner returns the node that serves a slot.
+func (c *fakeCluster) owner(slot int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if slot < c.split {
+		return c.nodes[0]
+	}
+
+	return c.nodes[1]
+}
+
+// slots returns the reply to CLUSTER SLOTS.
+func (c *fakeCluster) slots() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node := func(start, end int, addr string) interface{} {
+		host, port, _ := net.SplitHostPort(addr)
+		p, _ := strconv.Atoi(port)
+
+		return []interface{}{int64(start), int64(end), []interface{}{[]byte(host), int64(p)}}
+	}
+
+	return []interface{}{node(0, c.split-1, c.nodes[0]), node(c.split, 16383, c.nodes[1])}
+}
+
+// fakeServer is a local stand-in for a Redis server, a sentinel or a node of a
+// cluster. It supports the commands used by the RedisStore.
+type fakeServer struct {
+	mu      sync.Mutex
+	addr    string
+	role    string
+	down    bool
+	master  []string
+	cluster *fakeCluster
+	hashes  map[string]map[string][]byte
+	sets    map[string]map[string]bool
+	ttls    map[string]int64
+	subs    map[string]map[*fakeConn]bool
+	version map[string]int64
+}
+
+// newFakeServer creates a fake master.
+func newFakeServer(addr string) *fakeServer {
+	return &fakeServer{
+		addr:    addr,
+		role:    "master",
+		hashes:  make(map[string]map[string][]byte),
+		sets:    make(map[string]map[string]bool),
+		ttls:    make(map[string]int64),
+		subs:    make(map[string]map[*fakeConn]bool),
+		version: make(map[string]int64),
+	}
+}
+
+// fakeDialer returns a Dial function that connects to the given servers.
+func fakeDialer(servers ...*fakeServer) func(string) (redis.Conn, error) {
+	return func(addr string) (redis.Conn, error) {
+		for _, server := range servers {
+			if server.addr == addr && !server.down {
+				return newFakeConn(server), nil
+			}
+		}
+
+		return nil, errors.New("connection refused")
+	}
+}
+
+// redirect checks if the keys of a command are served by this node.
+func (s *fakeServer) redirect(keys ...string) error {
+	if s.cluster == nil || len(keys) == 0 {
+		return nil
+	}
+
+	slot := cookie.HashSlot(keys[0])
+	for _, key := range keys[1:] {
+		if cookie.HashSlot(key) != slot {
+			return redis.Error("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+
+	if owner := s.cluster.owner(slot); owner != s.addr {
+		return redis.Error("MOVED " + strconv.Itoa(slot) + " " + owner)
+	}
+
+	return nil
+}
+
+// keys returns the keys of a command.
+func keys(cmd string, args []string) []string {
+	switch cmd {
+	case "RENAME", "RENAMENX":
+		return args[:2]
+	case "HGET", "HSET", "HMSET", "HDEL", "HGETALL", "PEXPIRE", "PERSIST", "DEL",
+		"DUMP", "PTTL", "RESTORE", "SADD", "SREM", "SMEMBERS", "TYPE", "EXISTS":
+		return args[:1]
+	}
+
+	return nil
+}
+
+// do executes a single command.
+func (s *fakeServer) do(cmd string, args []string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.run(cmd, args)
+}
+
+// transaction executes the queued commands of a transaction. If a watched key
+// was changed, nothing is executed and the result is nil.
+func (s *fakeServer) transaction(watched map[string]int64, queued []fakeCommand) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, version := range watched {
+		if s.version[key] != version {
+			return nil
+		}
+	}
+
+	result := []interface{}{}
+	for _, command := range queued {
+		result = append(result, s.run(command.cmd, command.args))
+	}
+
+	return result
+}
+
+// watch returns the current version of a key.
+func (s *fakeServer) watch(key string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.version[key]
+}
+
+// run executes a single command. The caller must hold the lock.
+func (s *fakeServer) run(cmd string, args []string) interface{} {
+	if err := s.redirect(keys(cmd, args)...); err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "HSET", "HMSET", "HDEL", "PEXPIRE", "PERSIST", "RENAME", "RENAMENX", "DEL", "RESTORE", "SADD", "SREM":
+		for _, key := range keys(cmd, args) {
+			s.version[key]++
+		}
+	}
+
+	switch cmd {
+	case "ROLE":
+		return []interface{}{[]byte(s.role)}
+	case "SENTINEL":
+		if s.master == nil {
+			return nil
+		}
+		return []interface{}{[]byte(s.master[0]), []byte(s.master[1])}
+	case "CLUSTER":
+		return s.cluster.slots()
+	case "ASKING":
+		return "OK"
+	case "HGET":
+		if value, ok := s.hashes[args[0]][args[1]]; ok {
+			return value
+		}
+		return nil
+	case "HSET", "HMSET":
+		if s.hashes[args[0]] == nil {
+			s.hashes[args[0]] = make(map[string][]byte)
+		}
+		for i := 1; i+1 < len(args); i += 2 {
+			s.hashes[args[0]][args[i]] = []byte(args[i+1])
+		}
+		return int64(1)
+	case "HDEL":
+		for _, field := range args[1:] {
+			delete(s.hashes[args[0]], field)
+		}
+		return int64(1)
+	case "HGETALL":
+		var result []interface{}
+		for field, value := range s.hashes[args[0]] {
+			result = append(result, []byte(field), value)
+		}
+		return result
+	case "PEXPIRE":
+		ttl, _ := strconv.ParseInt(args[1], 10, 64)
+		s.ttls[args[0]] = ttl
+		return int64(1)
+	case "PERSIST":
+		delete(s.ttls, args[0])
+		return int64(1)
+	case "PTTL":
+		if ttl, ok := s.ttls[args[0]]; ok {
+			return ttl
+		}
+		return int64(-1)
+	case "RENAME":
+		values, ok := s.hashes[args[0]]
+		if !ok {
+			return redis.Error("ERR no such key")
+		}
+		s.hashes[args[1]] = values
+		delete(s.hashes, args[0])
+		return "OK"
+	case "RENAMENX":
+		if _, ok := s.hashes[args[1]]; ok {
+			return int64(0)
+		}
+		s.hashes[args[1]] = s.hashes[args[0]]
+		delete(s.hashes, args[0])
+		return int64(1)
+	case "DEL":
+		delete(s.hashes, args[0])
+		delete(s.sets, args[0])
+		delete(s.ttls, args[0])
+		return int64(1)
+	case "EXISTS":
+		_, hash := s.hashes[args[0]]
+		_, set := s.sets[args[0]]
+		if hash || set {
+			return int64(1)
+		}
+		return int64(0)
+	case "TYPE":
+		if _, ok := s.hashes[args[0]]; ok {
+			return "hash"
+		}
+		if _, ok := s.sets[args[0]]; ok {
+			return "set"
+		}
+		return "none"
+	case "SCAN":
+		var result []interface{}
+		for _, keys := range []interface{}{s.hashes, s.sets} {
+			for _, key := range reflect.ValueOf(keys).MapKeys() {
+				if ok, _ := path.Match(args[2], key.String()); ok {
+					result = append(result, []byte(key.String()))
+				}
+			}
+		}
+		return []interface{}{[]byte("0"), result}
+	case "DUMP":
+		values, ok := s.hashes[args[0]]
+		if !ok {
+			return nil
+		}
+		data, _ := json.Marshal(values)
+		return data
+	case "RESTORE":
+		var values map[string][]byte
+		json.Unmarshal([]byte(args[2]), &values)
+		s.hashes[args[0]] = values
+		if ttl, _ := strconv.ParseInt(args[1], 10, 64); ttl > 0 {
+			s.ttls[args[0]] = ttl
+		}
+		return "OK"
+	case "SADD":
+		if s.sets[args[0]] == nil {
+			s.sets[args[0]] = make(map[string]bool)
+		}
+		s.sets[args[0]][args[1]] = true
+		return int64(1)
+	case "SREM":
+		delete(s.sets[args[0]], args[1])
+		return int64(1)
+	case "SMEMBERS":
+		var result []interface{}
+		for member := range s.sets[args[0]] {
+			result = append(result, []byte(member))
+		}
+		return result
+	}
+
+	return redis.Error("ERR unknown command " + cmd)
+}
+
+// fakeCommand is a command that was sent, but not flushed yet.
+type fakeCommand struct {
+	cmd  string
+	args []string
+}
+
+// fakeArgs converts the arguments of a command into strings.
+func fakeArgs(args []interface{}) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		if data, ok := arg.([]byte); ok {
+			result[i] = string(data)
+		} else {
+			result[i] = fmt.Sprint(arg)
+		}
+	}
+
+	return result
+}
+
+// fakeConn is a connection to a fakeServer with the semantics of redigo.
+type fakeConn struct {
+	server  *fakeServer
+	pending []fakeCommand
+	queued  []fakeCommand
+	multi   bool
+	aborted bool
+	err     error
+	watched map[string]int64
+	inbox   chan interface{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newFakeConn(server *fakeServer) *fakeConn {
+	return &fakeConn{
+		server: server,
+		inbox:  make(chan interface{}, 64),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *fakeConn) Close() error {
+	c.once.Do(func() {
+		c.server.unsubscribe(c)
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *fakeConn) Err() error { return c.err }
+
+// Flush sends the pending commands, their replies are read with Receive.
+func (c *fakeConn) Flush() error {
+	commands := c.pending
+	c.pending = nil
+
+	for _, command := range commands {
+		c.inbox <- c.exec(command)
+	}
+
+	return nil
+}
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	select {
+	case reply := <-c.inbox:
+		if err, ok := reply.(redis.Error); ok {
+			return nil, err
+		}
+		return reply, nil
+	case <-c.closed:
+		return nil, errors.New("connection closed")
+	}
+}
+
+func (c *fakeConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.Receive()
+}
+
+func (c *fakeConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return c.Do(cmd, args...)
+}
+
+func (c *fakeConn) Send(cmd string, args ...interface{}) error {
+	c.pending = append(c.pending, fakeCommand{cmd, fakeArgs(args)})
+	return nil
+}
+
+// Do sends all pending commands and the given one. Like redigo it returns the
+// last reply and the first error.
+func (c *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	commands := c.pending
+	if cmd != "" {
+		commands = append(commands, fakeCommand{cmd, fakeArgs(args)})
+	}
+	c.pending = nil
+
+	var reply interface{}
+	var err error
+	for _, command := range commands {
+		reply = c.exec(command)
+		if e, ok := reply.(redis.Error); ok && err == nil {
+			err = e
+		}
+	}
+
+	return reply, err
+}
+
+// exec executes a command and handles transactions.
+func (c *fakeConn) exec(command fakeCommand) interface{} {
+	if c.server.down {
+		c.err = errors.New("connection closed")
+		return redis.Error("connection closed")
+	}
+
+	switch {
+	case command.cmd == "SUBSCRIBE":
+		return c.server.subscribe(c, command.args[0])
+	case command.cmd == "UNSUBSCRIBE" || command.cmd == "PUNSUBSCRIBE":
+		c.server.unsubscribe(c)
+		return []interface{}{[]byte(strings.ToLower(command.cmd)), nil, int64(0)}
+	case command.cmd == "ECHO":
+		return []byte(command.args[0])
+	case command.cmd == "WATCH":
+		if c.watched == nil {
+			c.watched = make(map[string]int64)
+		}
+		c.watched[command.args[0]] = c.server.watch(command.args[0])
+		return "OK"
+	case command.cmd == "UNWATCH":
+		c.watched = nil
+		return "OK"
+	case command.cmd == "MULTI":
+		c.multi, c.aborted, c.queued = true, false, nil
+		return "OK"
+	case command.cmd == "EXEC":
+		c.multi = false
+		if c.aborted {
+			return redis.Error("EXECABORT Transaction discarded because of previous errors.")
+		}
+
+		watched := c.watched
+		c.watched = nil
+		return c.server.transaction(watched, c.queued)
+	case c.multi:
+		if err := c.server.redirect(keys(command.cmd, command.args)...); err != nil {
+			c.aborted = true
+			return err
+		}
+		c.queued = append(c.queued, command)
+		return "QUEUED"
+	}
+
+	return c.server.do(command.cmd, command.args)
+}
+
+// subscribe adds a subscriber to a channel.
+func (s *fakeServer) subscribe(c *fakeConn, channel string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.subs[channel] == nil {
+		s.subs[channel] = make(map[*fakeConn]bool)
+	}
+	s.subs[channel][c] = true
+
+	return []interface{}{[]byte("subscribe"), []byte(channel), int64(1)}
+}
+
+// unsubscribe removes a subscriber from all channels.
+func (s *fakeServer) unsubscribe(c *fakeConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, subs := range s.subs {
+		delete(subs, c)
+	}
+}
+
+// subscribers returns the number of subscribers of a channel.
+func (s *fakeServer) subscribers(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.subs[channel])
+}
+
+// expire removes a key and publishes the keyspace notification of Redis.
+func (s *fakeServer) expire(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.hashes, key)
+	delete(s.ttls, key)
+
+	channel := "__keyevent@0__:expired"
+	for c := range s.subs[channel] {
+		c.inbox <- []interface{}{[]byte("message"), []byte(channel), []byte(key)}
+	}
+}
+
+// roundTrip creates a session, stores a value and reads it with a second
+// request. It returns the session of the second request.
+func roundTrip(t *testing.T, newCookie cookie.CookieFunc) cookie.Cookie {
+	w := New(t)
+	c, err := newCookie(w, &http.Request{Header: make(http.Header)}, "demo")
+	So(err, ShouldBeNil)
+
+	c.SetValue("name", "demo")
+	c.Store()
+
+	next, err := newCookie(New(t), nextRequest(w), "demo")
+	So(err, ShouldBeNil)
+	So(next.GetSessionID(), ShouldEqual, c.GetSessionID())
+	So(next.GetString("name"), ShouldEqual, "demo")
+
+	return next
+}
+
+func TestHashSlot(t *testing.T) {
+	Convey("HashSlot should match the slots of Redis Cluster.", t, func() {
+		So(cookie.HashSlot("123456789"), ShouldEqual, 12739)
+		So(cookie.HashSlot("foo"), ShouldEqual, 12182)
+		So(cookie.HashSlot("{user1000}.following"), ShouldEqual, cookie.HashSlot("{user1000}.followers"))
+		So(cookie.HashSlot("{}foo"), ShouldEqual, cookie.HashSlot("{}foo"))
+	})
+}
+
+func TestPoolProvider(t *testing.T) {
+	Convey("A RedisStore with a pool should keep the sessions in Redis.", t, func() {
+		server := newFakeServer("127.0.0.1:6379")
+		dial := fakeDialer(server)
+		pool := &redis.Pool{Dial: func() (redis.Conn, error) { return dial(server.addr) }}
+
+		newCookie := cookie.NewRedis(pool, cookie.Buffered())
+		c := roundTrip(t, newCookie)
+
+		So(c.AddFlash(cookie.FlashInfo, "hello"), ShouldBeNil)
+		c.Store()
+
+		messages, err := c.Flashes(cookie.FlashInfo)
+		So(err, ShouldBeNil)
+		So(messages, ShouldResemble, []string{"hello"})
+
+		So(c.SetUser("alice"), ShouldBeNil)
+		c.Store()
+
+		sessions, err := cookie.UserSessions(cookie.NewRedisStore(pool), "alice")
+		So(err, ShouldBeNil)
+		So(sessions, ShouldHaveLength, 1)
+		So(sessions[0].ID, ShouldEqual, c.GetSessionID())
+	})
+}
+
+func TestSentinelProvider(t *testing.T) {
+	Convey("A SentinelProvider should use the master that the sentinels report.", t, func() {
+		first := newFakeServer("10.0.0.1:6379")
+		second := newFakeServer("10.0.0.2:6379")
+		second.role = "slave"
+
+		sentinel := newFakeServer("10.0.0.9:26379")
+		sentinel.master = []string{"10.0.0.1", "6379"}
+
+		dead := newFakeServer("10.0.0.8:26379")
+		dead.down = true
+
+		provider := cookie.NewSentinelProvider("mymaster", []string{dead.addr, sentinel.addr}, fakeDialer(first, second, sentinel, dead))
+		newCookie := cookie.NewRedisProvider(provider)
+
+		addr, err := provider.MasterAddr()
+		So(err, ShouldBeNil)
+		So(addr, ShouldEqual, first.addr)
+		So(provider.Sentinels[0], ShouldEqual, sentinel.addr)
+
+		c := roundTrip(t, newCookie)
+		So(first.hashes[c.GetSessionID()], ShouldNotBeEmpty)
+
+		Convey("A replica should not be used as master", func() {
+			sentinel.master = []string{"10.0.0.2", "6379"}
+
+			replica := cookie.NewSentinelProvider("mymaster", []string{sentinel.addr}, fakeDialer(second, sentinel))
+			_, err := cookie.NewRedisProviderStore(replica).Get("id", "name")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("After a failover the new master should be used", func() {
+			first.down = true
+			second.role = "master"
+			sentinel.master = []string{"10.0.0.2", "6379"}
+
+			// The connection to the old master fails once
+			store := cookie.NewRedisProviderStore(provider)
+			store.Set("failover", "name", []byte("before"))
+
+			So(store.Set("failover", "name", []byte("after")), ShouldBeNil)
+			So(string(second.hashes["failover"]["name"]), ShouldEqual, "after")
+		})
+	})
+}
+
+func TestClusterProvider(t *testing.T) {
+	Convey("A ClusterProvider should route every session to the node of it's slot.", t, func() {
+		cluster := &fakeCluster{split: 8192, nodes: [2]string{"10.0.1.1:7000", "10.0.1.2:7000"}}
+		first := newFakeServer(cluster.nodes[0])
+		second := newFakeServer(cluster.nodes[1])
+		first.cluster, second.cluster = cluster, cluster
+
+		provider := cookie.NewClusterProvider([]string{first.addr}, fakeDialer(first, second))
+		newCookie := cookie.NewRedisProvider(provider, cookie.IdleTimeout(time.Hour))
+
+		// node returns the server that holds a key
+		node := func(key string) *fakeServer {
+			if cookie.HashSlot(key) < cluster.split {
+				return first
+			}
+			return second
+		}
+
+		for i := 0; i < 10; i++ {
+			c := roundTrip(t, newCookie)
+			So(node(c.GetSessionID()).hashes[c.GetSessionID()]["name"], ShouldResemble, []byte(`"demo"`))
+		}
+
+		Convey("Regenerate should move the session to the slot of the new ID", func() {
+			c := roundTrip(t, newCookie)
+			id := c.GetSessionID()
+
+			for cookie.HashSlot(c.GetSessionID()) < cluster.split == (cookie.HashSlot(id) < cluster.split) {
+				So(c.Regenerate(New(t)), ShouldBeNil)
+			}
+
+			So(node(id).hashes, ShouldNotContainKey, id)
+			So(node(c.GetSessionID()).hashes[c.GetSessionID()]["name"], ShouldResemble, []byte(`"demo"`))
+			So(node(c.GetSessionID()).ttls[c.GetSessionID()], ShouldBeGreaterThan, 0)
+		})
+
+		Convey("A MOVED redirection should reload the slots", func() {
+			store := cookie.NewRedisProviderStore(provider)
+
+			// "foo" lives on slot 12182, which moves to the first node
+			cluster.mu.Lock()
+			cluster.split = 16000
+			cluster.mu.Unlock()
+
+			So(store.Set("foo", "name", []byte("moved")), ShouldBeNil)
+			So(string(first.hashes["foo"]["name"]), ShouldEqual, "moved")
+
+			value, err := store.Get("foo", "name")
+			So(err, ShouldBeNil)
+			So(string(value), ShouldEqual, "moved")
+		})
+	})
+}
@@ -3,233 +3,406 @@
 package cookie
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/anihex/server-utils/tools"
 	"github.com/garyburd/redigo/redis"
 )
 
-// RedisCookie ist ein einfaches Interface für Redis basierte Sessions
-type RedisCookie struct {
-	Cookie    http.Cookie
-	Pool      *redis.Pool
-	SessionID string
-	stored    bool
-	w         http.ResponseWriter
-	r         *http.Request
-	name      string
+// RedisStore is a Store that keeps every session in a Redis hash. The key of
+// the hash is the session ID with the Prefix in front of it. The connections
+// are taken from the Provider, or from the Pool if no Provider is set.
+type RedisStore struct {
+	Pool     *redis.Pool
+	Provider Provider
+	Prefix   string
 }
 
-// GetCookie returns the http Cookie of the cookie
-func (session *RedisCookie) GetCookie() http.Cookie {
-	return session.Cookie
+// NewRedisStore creates a new RedisStore using the given pool.
+func NewRedisStore(Pool *redis.Pool) *RedisStore {
+	return &RedisStore{Pool: Pool, Provider: &PoolProvider{Pool}}
 }
 
-// GetConn returns the redis pool of the cookie
-func (session *RedisCookie) GetConn() *redis.Pool {
-	return session.Pool
+// NewRedisProviderStore creates a new RedisStore that takes it's connections
+// from the given Provider.
+func NewRedisProviderStore(p Provider) *RedisStore {
+	store := &RedisStore{Provider: p}
+	if pp, ok := p.(*PoolProvider); ok {
+		store.Pool = pp.Pool
+	}
+
+	return store
 }
 
-// GetSessionID returns the SessionID of the cookie
-func (session *RedisCookie) GetSessionID() string {
-	return session.SessionID
+// Exists reports if the hash of a session exists.
+func (s *RedisStore) Exists(id string) (bool, error) {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
+
+	return redis.Bool(conn.Do("EXISTS", key))
 }
 
-// GetValue reads a value from redis and returns it
-func (session *RedisCookie) GetValue(Name string) []byte {
-	resultObj, err := session.Pool.Get().Do("HGET", session.SessionID, Name)
-	if err != nil {
-		return []byte{}
-	}
+// Namespaced returns a copy of the store that uses the given Prefix.
+func (s *RedisStore) Namespaced(prefix string) Store {
+	result := *s
+	result.Prefix = prefix
 
-	resultByte, _ := resultObj.([]byte)
+	return &result
+}
 
-	return resultByte
+// key returns the key of the hash of a session.
+func (s *RedisStore) key(id string) string {
+	return s.Prefix + id
 }
 
-// SetValue stores a value in redis
-func (session *RedisCookie) SetValue(Name string, Value interface{}) {
-	session.Pool.Get().Do("HSET", session.SessionID, Name, Value)
+// conn returns a connection to the server that holds the key.
+func (s *RedisStore) conn(key string) redis.Conn {
+	if s.Provider == nil {
+		return s.Pool.Get()
+	}
 
-	session.Store()
+	return s.Provider.Get(key)
 }
 
-// GetUint64 reads a value from redis and returs it as uint64
-func (session *RedisCookie) GetUint64(Name string) uint64 {
-	data := session.GetValue(Name)
-	var result uint64
-	err := json.Unmarshal(data, &result)
+// Get returns the value of a field. If the field doesn't exist, ErrNotFound
+// is returned.
+func (s *RedisStore) Get(id, field string) ([]byte, error) {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
 
-	if err != nil {
-		result = 0
+	result, err := redis.Bytes(conn.Do("HGET", key, field))
+	if err == redis.ErrNil {
+		return nil, ErrNotFound
 	}
 
-	return result
+	return result, err
 }
 
-// GetBool reads a value from redis and returns it as bool
-func (session *RedisCookie) GetBool(Name string) bool {
-	data := session.GetValue(Name)
+// Set stores the value of a field.
+func (s *RedisStore) Set(id, field string, value []byte) error {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
 
-	var result bool
-	err := json.Unmarshal(data, &result)
+	_, err := conn.Do("HSET", key, field, value)
 
-	log.Println(data, result)
+	return err
+}
 
-	if err != nil {
-		result = false
-	}
+// Delete removes a field.
+func (s *RedisStore) Delete(id, field string) error {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
 
-	return result
+	_, err := conn.Do("HDEL", key, field)
+
+	return err
 }
 
-// GetInt64 reads a value from redis and returns it as int64
-func (session *RedisCookie) GetInt64(Name string) int64 {
-	data := session.GetValue(Name)
-	var result int64
-	err := json.Unmarshal(data, &result)
+// GetAll returns all fields of a session.
+func (s *RedisStore) GetAll(id string) (map[string][]byte, error) {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
 
+	values, err := redis.ByteSlices(conn.Do("HGETALL", key))
 	if err != nil {
-		result = 0
+		return nil, err
 	}
 
-	return result
+	result := make(map[string][]byte, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		result[string(values[i])] = values[i+1]
+	}
+
+	return result, nil
 }
 
-// GetString reads a value from redis and returs it as string
-func (session *RedisCookie) GetString(Name string) string {
-	value := session.GetValue(Name)
+// Expire sets the time to live of a session. A ttl of 0 or less makes the
+// session persistent.
+func (s *RedisStore) Expire(id string, ttl time.Duration) error {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
+
+	var err error
+	if ttl <= 0 {
+		_, err = conn.Do("PERSIST", key)
+	} else {
+		_, err = conn.Do("PEXPIRE", key, int64(ttl/time.Millisecond))
+	}
 
-	return fmt.Sprintf("%s", value)
+	return err
 }
 
-// SetInterface stores an Interface using JSON encoding
-func (session *RedisCookie) SetInterface(Name string, Value interface{}) error {
-	ToStore, err := json.Marshal(Value)
+// Rename moves all fields of a session to a new ID using RENAME. The time to
+// live of the session is kept. Renaming a session that doesn't exist is not
+// an error. In a cluster the IDs usually live on different slots, so the
+// session is copied with DUMP and RESTORE instead.
+func (s *RedisStore) Rename(id, newID string) error {
+	key, newKey := s.key(id), s.key(newID)
+
+	conn := s.conn(key)
+	defer conn.Close()
+
+	_, err := conn.Do("RENAME", key, newKey)
+	if err, ok := err.(redis.Error); ok && strings.Contains(err.Error(), "no such key") {
+		return nil
+	}
+
+	if err, ok := err.(redis.Error); ok && strings.HasPrefix(err.Error(), "CROSSSLOT") {
+		return s.move(conn, key, newKey)
+	}
+
+	return err
+}
+
+// move copies a key to another slot and deletes the old key. The connection
+// has to belong to the server of the old key.
+func (s *RedisStore) move(conn redis.Conn, key, newKey string) error {
+	conn.Send("MULTI")
+	conn.Send("DUMP", key)
+	conn.Send("PTTL", key)
+
+	values, err := redis.Values(conn.Do("EXEC"))
 	if err != nil {
 		return err
 	}
 
-	session.SetValue(Name, ToStore)
+	if len(values) != 2 || values[0] == nil {
+		return nil
+	}
 
-	return nil
-}
+	ttl, err := redis.Int64(values[1], nil)
+	if err != nil {
+		return err
+	}
 
-// GetInterface reads a JSON value from redis and binds it to the o interface
-func (session *RedisCookie) GetInterface(Name string, o interface{}) error {
-	data := session.GetValue(Name)
-	err := json.Unmarshal(data, &o)
+	if ttl < 0 {
+		ttl = 0
+	}
 
-	return err
-}
+	target := s.conn(newKey)
+	defer target.Close()
+
+	if _, err := target.Do("RESTORE", newKey, ttl, values[0], "REPLACE"); err != nil {
+		return err
+	}
 
-// GetUint64Array reads a value from redis and returns it as uint64 array
-func (session *RedisCookie) GetUint64Array(Name string) []uint64 {
-	data := session.GetValue(Name)
-	var result []uint64
-	json.Unmarshal(data, &result)
+	_, err = conn.Do("DEL", key)
 
-	return result
+	return err
 }
 
-// DeleteValue deletes a value from redis
-func (session *RedisCookie) DeleteValue(Name string) error {
-	session.Pool.Get().Do("HDEL", session.SessionID, Name)
+// Take returns the value of a field and deletes it. HGET and HDEL are sent in
+// a single MULTI/EXEC transaction, so a value is only returned once.
+func (s *RedisStore) Take(id, field string) ([]byte, error) {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
 
-	session.Store()
+	conn.Send("MULTI")
+	conn.Send("HGET", key, field)
+	conn.Send("HDEL", key, field)
 
-	return nil
-}
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return nil, err
+	}
 
-// Remove deletes all entries in redis. It also invalidates the http cookie
-func (session *RedisCookie) Remove(w http.ResponseWriter) {
-	session.Pool.Get().Do("DEL", session.SessionID)
-	session.SessionID = ""
-	session.Cookie.Value = ""
-	session.Cookie.Expires = time.Unix(0, 0)
+	if len(values) == 0 || values[0] == nil {
+		return nil, ErrNotFound
+	}
 
-	http.SetCookie(w, &session.Cookie)
+	return redis.Bytes(values[0], nil)
 }
 
-// SetSessionID forces a change of the session-ID
-func (session *RedisCookie) SetSessionID(w http.ResponseWriter, id string) {
-	session.Cookie.Value = id
-	session.SessionID = id
+// Apply sets and deletes the given fields of a session in a single MULTI/EXEC
+// transaction. A ttl greater than 0 also sets the time to live of the session.
+func (s *RedisStore) Apply(id string, set map[string][]byte, del []string, ttl time.Duration) error {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
 
-	http.SetCookie(w, &session.Cookie)
-}
+	conn.Send("MULTI")
+
+	if len(set) > 0 {
+		args := redis.Args{}.Add(key)
+		for k, v := range set {
+			args = args.Add(k, v)
+		}
+		conn.Send("HMSET", args...)
+	}
 
-// Store saves the http-Cookie if neccessary
-func (session *RedisCookie) Store() {
-	if session.stored {
-		return
+	if len(del) > 0 {
+		conn.Send("HDEL", redis.Args{}.Add(key).AddFlat(del)...)
 	}
 
-	if _, err := session.r.Cookie(session.name); err != nil {
-		http.SetCookie(session.w, &session.Cookie)
+	if ttl > 0 {
+		conn.Send("PEXPIRE", key, int64(ttl/time.Millisecond))
 	}
 
-	session.stored = true
+	_, err := conn.Do("EXEC")
+
+	return err
 }
 
-// NewRedisCookie creates a new redis cookie
-func NewRedisCookie(w http.ResponseWriter, r *http.Request, Name string, Conn *redis.Pool) (Cookie, error) {
-	var token string
+// Update replaces the value of a field with the result of f. The key of the
+// session is watched while f runs, so the transaction that writes the value
+// fails if another request changed the session in between. Then f is called
+// again with the new value.
+func (s *RedisStore) Update(id, field string, f func(old []byte) ([]byte, error)) error {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
 
-	cookie, err := r.Cookie(Name)
-	if err != nil {
-		token = tools.GID(32)
+	for i := 0; i < updateAttempts; i++ {
+		backoff(i)
 
-		if w == nil {
-			return &RedisCookie{}, errors.New("responseWriter not set")
+		if _, err := conn.Do("WATCH", key); err != nil {
+			return err
 		}
 
-		if r == nil {
-			return &RedisCookie{}, errors.New("request not set")
+		old, err := redis.Bytes(conn.Do("HGET", key, field))
+		if err != nil && err != redis.ErrNil {
+			return err
 		}
 
-		c := http.Cookie{
-			Name:    Name,
-			Path:    "/",
-			Expires: time.Unix(time.Now().Unix()+(60*60*24*365*10), 0),
-			Value:   token,
-			//Secure:   true,
-			HttpOnly: true,
+		value, err := f(old)
+		if err != nil {
+			conn.Do("UNWATCH")
+			return err
+		}
+
+		conn.Send("MULTI")
+		conn.Send("HSET", key, field, value)
+
+		reply, err := conn.Do("EXEC")
+		if err != nil {
+			return err
 		}
 
-		return &RedisCookie{
-			Pool:      Conn,
-			SessionID: c.Value,
-			Cookie:    c,
-			w:         w,
-			r:         r,
-			name:      Name,
-		}, nil
+		// EXEC returns nil if the watched key was changed
+		if reply != nil {
+			return nil
+		}
 	}
 
-	if strings.TrimSpace(cookie.Value) == "" {
-		return &RedisCookie{}, errors.New("request contained empty value")
+	return ErrConflict
+}
+
+// Destroy removes a session and all of it's fields.
+func (s *RedisStore) Destroy(id string) error {
+	key := s.key(id)
+	conn := s.conn(key)
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", key)
+
+	return err
+}
+
+// userKey returns the key of the set that holds the session IDs of a user.
+// Session IDs never contain a ':', so a session cookie can't point to it.
+func (s *RedisStore) userKey(user string) string {
+	return s.Prefix + "sessions:" + user
+}
+
+// Index adds a session to the set of sessions of a user.
+func (s *RedisStore) Index(user, id string) error {
+	conn := s.conn(s.userKey(user))
+	defer conn.Close()
+
+	_, err := conn.Do("SADD", s.userKey(user), id)
+
+	return err
+}
+
+// Unindex removes a session from the set of sessions of a user.
+func (s *RedisStore) Unindex(user, id string) error {
+	conn := s.conn(s.userKey(user))
+	defer conn.Close()
+
+	_, err := conn.Do("SREM", s.userKey(user), id)
+
+	return err
+}
+
+// Sessions returns the IDs of the sessions of a user.
+func (s *RedisStore) Sessions(user string) ([]string, error) {
+	conn := s.conn(s.userKey(user))
+	defer conn.Close()
+
+	return redis.Strings(conn.Do("SMEMBERS", s.userKey(user)))
+}
+
+// RedisCookie ist ein einfaches Interface für Redis basierte Sessions
+type RedisCookie struct {
+	*StoreCookie
+	Pool     *redis.Pool
+	Provider Provider
+}
+
+// GetConn returns the redis pool of the cookie. It is nil if the cookie uses a
+// Provider that isn't a PoolProvider.
+func (session *RedisCookie) GetConn() *redis.Pool {
+	return session.Pool
+}
+
+// GetProvider returns the connection provider of the cookie
+func (session *RedisCookie) GetProvider() Provider {
+	return session.Provider
+}
+
+// NewRedisCookie creates a new redis cookie
+func NewRedisCookie(w http.ResponseWriter, r *http.Request, Name string, Conn *redis.Pool, opts ...Option) (Cookie, error) {
+	store := NewRedisStore(Conn)
+
+	session, err := NewStoreCookie(w, r, Name, store, opts...)
+	if err != nil {
+		return &RedisCookie{}, err
 	}
 
-	if cookie.Value != "0" {
-		token = cookie.Value
+	return &RedisCookie{
+		StoreCookie: session,
+		Pool:        Conn,
+		Provider:    &PoolProvider{Conn},
+	}, nil
+}
+
+// NewRedisProviderCookie creates a new redis cookie that takes it's
+// connections from the given Provider.
+func NewRedisProviderCookie(w http.ResponseWriter, r *http.Request, Name string, p Provider, opts ...Option) (Cookie, error) {
+	store := NewRedisProviderStore(p)
+
+	session, err := NewStoreCookie(w, r, Name, store, opts...)
+	if err != nil {
+		return &RedisCookie{}, err
 	}
 
-	cookie.Path = "/"
-	result := &RedisCookie{
-		Pool:      Conn,
-		SessionID: token,
-		Cookie:    *cookie,
-		w:         w,
-		r:         r,
-		name:      Name,
+	return &RedisCookie{
+		StoreCookie: session,
+		Pool:        store.Pool,
+		Provider:    p,
+	}, nil
+}
+
+// NewRedis returns a CookieFunc that creates redis cookies using the given
+// pool.
+func NewRedis(Conn *redis.Pool, opts ...Option) CookieFunc {
+	return func(w http.ResponseWriter, r *http.Request, Name string) (Cookie, error) {
+		return NewRedisCookie(w, r, Name, Conn, opts...)
 	}
+}
 
-	return result, nil
+// NewRedisProvider returns a CookieFunc that creates redis cookies using the
+// given Provider, e.g. a SentinelProvider or a ClusterProvider.
+func NewRedisProvider(p Provider, opts ...Option) CookieFunc {
+	return func(w http.ResponseWriter, r *http.Request, Name string) (Cookie, error) {
+		return NewRedisProviderCookie(w, r, Name, p, opts...)
+	}
 }
@@ -0,0 +1,78 @@
+// +build redis
+
+package cookie_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedisUpdate(t *testing.T) {
+	Convey("Update should use WATCH so concurrent requests don't lose changes.", t, func() {
+		server := newFakeServer("127.0.0.1:6379")
+		dial := fakeDialer(server)
+		pool := &redis.Pool{Dial: func() (redis.Conn, error) { return dial(server.addr) }}
+
+		store := cookie.NewRedisStore(pool)
+		newCookie := cookie.NewRedis(pool, cookie.IdleTimeout(time.Hour))
+
+		c, _ := newCookie(New(t), &http.Request{Header: make(http.Header)}, "demo")
+		c.SetValue("name", "demo")
+		c.Store()
+
+		for _, err := range addItems(t, newCookie, c, 20) {
+			So(err, ShouldBeNil)
+		}
+
+		var cart []string
+		So(c.GetInterface("cart", &cart), ShouldBeNil)
+		So(cart, ShouldHaveLength, 20)
+
+		Convey("A session that keeps changing should return ErrConflict", func() {
+			var attempts int
+			err := store.Update(c.GetSessionID(), "count", func(old []byte) ([]byte, error) {
+				attempts++
+				store.Set(c.GetSessionID(), "count", []byte(strconv.Itoa(attempts)))
+				return []byte("0"), nil
+			})
+
+			So(err, ShouldEqual, cookie.ErrConflict)
+			So(attempts, ShouldEqual, 10)
+		})
+	})
+}
+
+func TestRedisUserIndex(t *testing.T) {
+	Convey("Session cookies shouldn't reach the user index of the store.", t, func() {
+		server := newFakeServer("127.0.0.1:6379")
+		dial := fakeDialer(server)
+		pool := &redis.Pool{Dial: func() (redis.Conn, error) { return dial(server.addr) }}
+
+		store := cookie.NewRedisStore(pool)
+		newCookie := cookie.NewRedis(pool)
+
+		c, _ := newCookie(New(t), &http.Request{Header: make(http.Header)}, "demo")
+		So(c.SetUser("alice"), ShouldBeNil)
+		So(server.sets, ShouldContainKey, "sessions:alice")
+
+		r := &http.Request{Header: make(http.Header)}
+		r.AddCookie(&http.Cookie{Name: "demo", Value: "sessions:alice"})
+
+		forged, err := newCookie(New(t), r, "demo")
+		So(err, ShouldBeNil)
+		So(forged.GetSessionID(), ShouldNotEqual, "sessions:alice")
+
+		forged.Remove(New(t))
+
+		sessions, err := cookie.UserSessions(store, "alice")
+		So(err, ShouldBeNil)
+		So(sessions, ShouldHaveLength, 1)
+	})
+}
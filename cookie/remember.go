@@ -0,0 +1,335 @@
+package cookie
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Lengths of the two parts of a remember-me token.
+const (
+	selectorLength  = 16
+	validatorLength = 32
+)
+
+// defaultGrace is the time the previous validator of a token stays valid.
+// Browsers often send several requests with the same cookie at once, only the
+// first one rotates the token.
+const defaultGrace = 30 * time.Second
+
+// tokenField is the field of a remember-me token that holds it's tokenState.
+const tokenField = "_token"
+
+// Errors of remember-me tokens.
+var (
+	// ErrInvalidToken is returned if a token is malformed, unknown or expired.
+	ErrInvalidToken = errors.New("invalid remember-me token")
+	// ErrTokenTheft is returned if a validator that was already used is sent
+	// again. All tokens and sessions of the user are revoked when this
+	// happens.
+	ErrTokenTheft = errors.New("remember-me token was reused")
+)
+
+// tokenState holds the hashes of the current and the previous validator of a
+// token.
+type tokenState struct {
+	Hash     string `json:"hash"`
+	Previous string `json:"previous,omitempty"`
+	Rotated  int64  `json:"rotated,omitempty"`
+}
+
+// Remember keeps users logged in after their session expired. It issues
+// long-lived tokens of a selector, which finds the token, and a validator,
+// which proves it. Only a hash of the validator is stored. Every use of a token
+// replaces the validator, so a validator that is sent again was stolen.
+//
+// The tokens are kept in the Store as well, they don't show up as sessions.
+// Grace is the time the previous validator stays valid after a rotation.
+type Remember struct {
+	Backend  Store
+	Lifetime time.Duration
+	Grace    time.Duration
+	name     string
+	opts     options
+}
+
+// NewRemember creates remember-me tokens that are valid for the given
+// Lifetime. The cookie with the given name is configured by the options.
+func NewRemember(store Store, Name string, Lifetime time.Duration, opts ...Option) *Remember {
+	o := newOptions(opts)
+	if o.maxAge <= 0 {
+		o.lifetime = Lifetime
+	}
+
+	return &Remember{
+		Backend:  store,
+		Lifetime: Lifetime,
+		Grace:    defaultGrace,
+		name:     Name,
+		opts:     o,
+	}
+}
+
+// tokenID returns the ID of the token with the given selector in the store.
+// Like all internal IDs it contains a ':', so it can't be used as a session ID.
+func tokenID(selector string) string {
+	return "remember:token:" + selector
+}
+
+// tokensID returns the ID of the hash that holds the selectors of the tokens
+// of a user.
+func tokensID(user string) string {
+	return "remember:user:" + user
+}
+
+// hashValidator returns the hash of a validator as it is stored.
+func hashValidator(validator string) string {
+	sum := sha256.Sum256([]byte(validator))
+	return hex.EncodeToString(sum[:])
+}
+
+// sameHash compares two hashes in constant time.
+func sameHash(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// setCookie sends the token to the client.
+func (rm *Remember) setCookie(w http.ResponseWriter, selector, validator string) {
+	c := rm.opts.httpCookie(rm.opts.cookieName(rm.name), selector+"."+validator, time.Now())
+	http.SetCookie(w, &c)
+}
+
+// clearCookie makes the client delete the token.
+func (rm *Remember) clearCookie(w http.ResponseWriter) {
+	c := rm.opts.expiredCookie(rm.opts.cookieName(rm.name))
+	http.SetCookie(w, &c)
+}
+
+// token reads the selector and the validator of the cookie of the request.
+// The result is false if there is no valid cookie.
+func (rm *Remember) token(r *http.Request) (string, string, bool) {
+	c, err := r.Cookie(rm.opts.cookieName(rm.name))
+	if err != nil {
+		return "", "", false
+	}
+
+	parts := strings.Split(c.Value, ".")
+	if len(parts) != 2 || len(parts[0]) != selectorLength || len(parts[1]) != validatorLength {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// Issue creates a new token for the user and sends it to the client. It should
+// be called on login if the user asked to be remembered.
+func (rm *Remember) Issue(w http.ResponseWriter, user string) error {
+	selector := rm.opts.generator(selectorLength)
+	validator := rm.opts.generator(validatorLength)
+
+	state, err := json.Marshal(tokenState{Hash: hashValidator(validator)})
+	if err != nil {
+		return err
+	}
+
+	values := map[string][]byte{
+		userField:    []byte(user),
+		createdField: encodeTime(time.Now()),
+		tokenField:   state,
+	}
+
+	if err := applyBatch(rm.Backend, tokenID(selector), values, nil, rm.Lifetime); err != nil {
+		return err
+	}
+
+	// Refreshes the expiry of the list, so it outlives all tokens of the user
+	set := map[string][]byte{selector: encodeTime(time.Now())}
+	if err := applyBatch(rm.Backend, tokensID(user), set, nil, rm.Lifetime); err != nil {
+		return err
+	}
+
+	rm.setCookie(w, selector, validator)
+
+	return nil
+}
+
+// Check validates the token of the request and returns it's user. The result
+// is empty if the request has no token. A valid token gets a new validator that
+// is sent to the client. If a used validator is sent again, all tokens of the
+// user are revoked and ErrTokenTheft is returned. If the store is an Indexer,
+// the sessions of the user are revoked as well.
+func (rm *Remember) Check(w http.ResponseWriter, r *http.Request) (string, error) {
+	if _, err := r.Cookie(rm.opts.cookieName(rm.name)); err != nil {
+		return "", nil
+	}
+
+	selector, validator, ok := rm.token(r)
+	if !ok {
+		rm.clearCookie(w)
+		return "", ErrInvalidToken
+	}
+
+	id := tokenID(selector)
+
+	user, err := rm.Backend.Get(id, userField)
+	if err == ErrNotFound {
+		rm.clearCookie(w)
+		return "", ErrInvalidToken
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	hash := hashValidator(validator)
+	next := rm.opts.generator(validatorLength)
+
+	var rotated bool
+	err = updateStore(rm.Backend, id, tokenField, func(old []byte) ([]byte, error) {
+		var state tokenState
+		if err := json.Unmarshal(old, &state); err != nil {
+			return nil, ErrInvalidToken
+		}
+
+		switch {
+		case sameHash(hash, state.Hash):
+			rotated = true
+			return json.Marshal(tokenState{
+				Hash:     hashValidator(next),
+				Previous: hash,
+				Rotated:  time.Now().UnixNano(),
+			})
+		case sameHash(hash, state.Previous) && time.Since(time.Unix(0, state.Rotated)) < rm.Grace:
+			// A concurrent request rotated the token, it sent the new cookie
+			rotated = false
+			return old, nil
+		}
+
+		return nil, ErrTokenTheft
+	})
+
+	if err == ErrTokenTheft {
+		rm.clearCookie(w)
+
+		if err := rm.RevokeUser(string(user)); err != nil {
+			return "", err
+		}
+
+		// The thief may already have a session
+		if _, ok := rm.Backend.(Indexer); ok {
+			if err := RevokeUserSessions(rm.Backend, string(user)); err != nil {
+				return "", err
+			}
+		}
+
+		return "", ErrTokenTheft
+	}
+
+	if err == ErrInvalidToken {
+		rm.clearCookie(w)
+		return "", err
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if rotated {
+		if err := rm.Backend.Expire(id, rm.Lifetime); err != nil {
+			return "", err
+		}
+
+		// The list has to live as long as the token, otherwise a stolen token
+		// can't be revoked
+		if err := rm.Backend.Expire(tokensID(string(user)), rm.Lifetime); err != nil {
+			return "", err
+		}
+
+		rm.setCookie(w, selector, next)
+	}
+
+	return string(user), nil
+}
+
+// Restore logs the user of the token into the session if the session doesn't
+// belong to a user yet. The session gets a new ID. The result reports if the
+// session was restored. Client cookies have no user index, so the user is only
+// kept in the cookie and their sessions can't be revoked on theft.
+func (rm *Remember) Restore(w http.ResponseWriter, r *http.Request, session Cookie) (bool, error) {
+	if session.GetUser() != "" {
+		return false, nil
+	}
+
+	user, err := rm.Check(w, r)
+	if err != nil || user == "" {
+		return false, err
+	}
+
+	if err := session.Regenerate(w); err != nil {
+		return false, err
+	}
+
+	if c, ok := session.(*ClientCookie); ok {
+		if err := c.bindUser(user); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	if err := session.SetUser(user); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Forget revokes the token of the request and deletes the cookie. It should be
+// called on logout.
+func (rm *Remember) Forget(w http.ResponseWriter, r *http.Request) error {
+	if _, err := r.Cookie(rm.opts.cookieName(rm.name)); err == nil {
+		rm.clearCookie(w)
+	}
+
+	selector, _, ok := rm.token(r)
+	if !ok {
+		return nil
+	}
+
+	user, err := rm.Backend.Get(tokenID(selector), userField)
+	if err == ErrNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := rm.Backend.Destroy(tokenID(selector)); err != nil {
+		return err
+	}
+
+	return rm.Backend.Delete(tokensID(string(user)), selector)
+}
+
+// RevokeUser revokes all tokens of a user, e.g. after the password was
+// changed.
+func (rm *Remember) RevokeUser(user string) error {
+	selectors, err := rm.Backend.GetAll(tokensID(user))
+	if err != nil {
+		return err
+	}
+
+	for selector := range selectors {
+		if err := rm.Backend.Destroy(tokenID(selector)); err != nil {
+			return err
+		}
+	}
+
+	return rm.Backend.Destroy(tokensID(user))
+}
@@ -0,0 +1,221 @@
+package cookie_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// tokenCookie returns the remember-me cookie that was sent with a response.
+func tokenCookie(w *FakeResponse) *http.Cookie {
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		if c.Name == "remember" {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// tokenRequest returns a request that sends a remember-me cookie.
+func tokenRequest(c *http.Cookie) *http.Request {
+	r := &http.Request{Header: make(http.Header)}
+	r.AddCookie(c)
+
+	return r
+}
+
+func TestRemember(t *testing.T) {
+	Convey("Remember-me tokens should log users in again.", t, func() {
+		store := cookie.NewMemoryStore()
+		remember := cookie.NewRemember(store, "remember", 30*24*time.Hour)
+
+		w := New(t)
+		So(remember.Issue(w, "alice"), ShouldBeNil)
+
+		issued := tokenCookie(w)
+		So(issued, ShouldNotBeNil)
+		So(issued.HttpOnly, ShouldBeTrue)
+		So(issued.Expires.After(time.Now().Add(29*24*time.Hour)), ShouldBeTrue)
+
+		Convey("Only a hash of the validator should be stored", func() {
+			validator := strings.Split(issued.Value, ".")[1]
+			selector := strings.Split(issued.Value, ".")[0]
+
+			values, _ := store.GetAll("remember:token:" + selector)
+			So(values, ShouldNotBeEmpty)
+			for _, value := range values {
+				So(string(value), ShouldNotContainSubstring, validator)
+			}
+		})
+
+		Convey("Check should return the user and rotate the validator", func() {
+			w := New(t)
+			user, err := remember.Check(w, tokenRequest(issued))
+			So(err, ShouldBeNil)
+			So(user, ShouldEqual, "alice")
+
+			rotated := tokenCookie(w)
+			So(rotated, ShouldNotBeNil)
+			So(rotated.Value, ShouldNotEqual, issued.Value)
+
+			user, err = remember.Check(New(t), tokenRequest(rotated))
+			So(err, ShouldBeNil)
+			So(user, ShouldEqual, "alice")
+		})
+
+		Convey("Concurrent requests with the old validator should be accepted shortly", func() {
+			remember.Check(New(t), tokenRequest(issued))
+
+			w := New(t)
+			user, err := remember.Check(w, tokenRequest(issued))
+			So(err, ShouldBeNil)
+			So(user, ShouldEqual, "alice")
+			So(tokenCookie(w), ShouldBeNil)
+		})
+
+		Convey("A replayed validator should revoke all tokens and sessions of the user", func() {
+			remember.Grace = 0
+
+			session, _ := cookie.New(store)(New(t), &http.Request{Header: make(http.Header)}, "demo")
+			session.SetUser("alice")
+
+			other := New(t)
+			remember.Issue(other, "alice")
+			remember.Issue(New(t), "bob")
+
+			w := New(t)
+			remember.Check(w, tokenRequest(issued))
+			rotated := tokenCookie(w)
+
+			w = New(t)
+			user, err := remember.Check(w, tokenRequest(issued))
+			So(err, ShouldEqual, cookie.ErrTokenTheft)
+			So(user, ShouldBeEmpty)
+			So(tokenCookie(w).MaxAge, ShouldBeLessThan, 0)
+
+			_, err = remember.Check(New(t), tokenRequest(rotated))
+			So(err, ShouldEqual, cookie.ErrInvalidToken)
+
+			_, err = remember.Check(New(t), tokenRequest(tokenCookie(other)))
+			So(err, ShouldEqual, cookie.ErrInvalidToken)
+
+			tokens, _ := store.GetAll("remember:user:bob")
+			So(tokens, ShouldHaveLength, 1)
+
+			sessions, _ := cookie.UserSessions(store, "alice")
+			So(sessions, ShouldBeEmpty)
+		})
+
+		Convey("A rotation should keep the tokens of the user revocable", func() {
+			short := cookie.NewRemember(store, "remember", 200*time.Millisecond)
+			short.Grace = 0
+
+			w := New(t)
+			short.Issue(w, "carol")
+			first := tokenCookie(w)
+
+			// Rotate after more than half of the lifetime
+			time.Sleep(120 * time.Millisecond)
+			w = New(t)
+			_, err := short.Check(w, tokenRequest(first))
+			So(err, ShouldBeNil)
+			rotated := tokenCookie(w)
+
+			// The list would have expired with the first token
+			time.Sleep(120 * time.Millisecond)
+			tokens, _ := store.GetAll("remember:user:carol")
+			So(tokens, ShouldHaveLength, 1)
+
+			_, err = short.Check(New(t), tokenRequest(first))
+			So(err, ShouldEqual, cookie.ErrTokenTheft)
+
+			_, err = short.Check(New(t), tokenRequest(rotated))
+			So(err, ShouldEqual, cookie.ErrInvalidToken)
+		})
+
+		Convey("Restore should log the user into a new session", func() {
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour))
+
+			w := New(t)
+			r := tokenRequest(issued)
+			session, _ := newCookie(w, r, "demo")
+			id := session.GetSessionID()
+
+			restored, err := remember.Restore(w, r, session)
+			So(err, ShouldBeNil)
+			So(restored, ShouldBeTrue)
+			So(session.GetUser(), ShouldEqual, "alice")
+			So(session.GetSessionID(), ShouldNotEqual, id)
+
+			restored, err = remember.Restore(New(t), tokenRequest(tokenCookie(w)), session)
+			So(err, ShouldBeNil)
+			So(restored, ShouldBeFalse)
+		})
+
+		Convey("Restore should log the user into a client cookie as well", func() {
+			keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+			newCookie := cookie.NewClient(keys)
+
+			w := New(t)
+			r := tokenRequest(issued)
+			session, _ := newCookie(w, r, "demo")
+			id := session.GetSessionID()
+
+			restored, err := remember.Restore(w, r, session)
+			So(err, ShouldBeNil)
+			So(restored, ShouldBeTrue)
+			So(session.GetUser(), ShouldEqual, "alice")
+			So(session.GetSessionID(), ShouldNotEqual, id)
+
+			next, _ := newCookie(New(t), nextRequest(w), "demo")
+			So(next.GetUser(), ShouldEqual, "alice")
+		})
+
+		Convey("Forget should revoke the token", func() {
+			w := New(t)
+			So(remember.Forget(w, tokenRequest(issued)), ShouldBeNil)
+			So(tokenCookie(w).MaxAge, ShouldBeLessThan, 0)
+
+			_, err := remember.Check(New(t), tokenRequest(issued))
+			So(err, ShouldEqual, cookie.ErrInvalidToken)
+
+			tokens, _ := store.GetAll("remember:user:alice")
+			So(tokens, ShouldBeEmpty)
+		})
+
+		Convey("Session cookies shouldn't reach the tokens of a user", func() {
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&http.Cookie{Name: "demo", Value: "remember:user:alice"})
+
+			session, err := cookie.New(store)(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(session.GetSessionID(), ShouldNotEqual, "remember:user:alice")
+
+			session.SetValue("forged", "value")
+			session.Remove(New(t))
+
+			tokens, _ := store.GetAll("remember:user:alice")
+			So(tokens, ShouldHaveLength, 1)
+
+			_, err = remember.Check(New(t), tokenRequest(issued))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Malformed tokens and requests without a token should be handled", func() {
+			w := New(t)
+			_, err := remember.Check(w, tokenRequest(&http.Cookie{Name: "remember", Value: "invalid"}))
+			So(err, ShouldEqual, cookie.ErrInvalidToken)
+			So(tokenCookie(w), ShouldNotBeNil)
+
+			user, err := remember.Check(New(t), &http.Request{Header: make(http.Header)})
+			So(err, ShouldBeNil)
+			So(user, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,190 @@
+// +build redis
+
+package cookie
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// scanCount is the number of keys SCAN looks at with every call.
+const scanCount = 1000
+
+// ErrNoPrefix is returned by the tools of a RedisStore that only work inside
+// a namespace.
+var ErrNoPrefix = errors.New("store has no prefix")
+
+// masters returns a connection to every server of the store. Providers of a
+// cluster return one connection per node.
+func (s *RedisStore) masters() []redis.Conn {
+	if p, ok := s.Provider.(interface{ Masters() []redis.Conn }); ok {
+		return p.Masters()
+	}
+
+	return []redis.Conn{s.conn("")}
+}
+
+// escapePattern escapes the special characters of a SCAN pattern.
+func escapePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
+
+// scan calls f for every key of the server that matches the pattern. It uses
+// SCAN, so the server isn't blocked.
+func scan(conn redis.Conn, pattern string, f func(key string) error) error {
+	cursor := "0"
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", scanCount))
+		if err != nil {
+			return err
+		}
+
+		if len(reply) != 2 {
+			return errors.New("cookie: invalid SCAN reply")
+		}
+
+		cursor, err = redis.String(reply[0], nil)
+		if err != nil {
+			return err
+		}
+
+		keys, err := redis.Strings(reply[1], nil)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if err := f(key); err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// scanPrefix calls f for every key inside the namespace of the store. Session
+// keys are passed with sessions set to true, the keys of the user index with
+// false.
+func (s *RedisStore) scanPrefix(f func(conn redis.Conn, key string, session bool) error) error {
+	if s.Prefix == "" {
+		return ErrNoPrefix
+	}
+
+	for _, conn := range s.masters() {
+		err := scan(conn, escapePattern(s.Prefix)+"*", func(key string) error {
+			// Session IDs don't contain colons, everything else belongs to
+			// the user index
+			id := strings.TrimPrefix(key, s.Prefix)
+
+			return f(conn, key, !strings.Contains(id, ":"))
+		})
+		conn.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Count returns the number of sessions in the namespace of the store. The
+// store needs a Prefix, otherwise ErrNoPrefix is returned.
+func (s *RedisStore) Count() (int, error) {
+	count := 0
+	err := s.scanPrefix(func(conn redis.Conn, key string, session bool) error {
+		if session {
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Purge deletes all sessions and the user index in the namespace of the
+// store. It returns the number of deleted sessions. The store needs a Prefix,
+// otherwise ErrNoPrefix is returned.
+func (s *RedisStore) Purge() (int, error) {
+	count := 0
+	err := s.scanPrefix(func(conn redis.Conn, key string, session bool) error {
+		if _, err := conn.Do("DEL", key); err != nil {
+			return err
+		}
+
+		if session {
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Migrate moves the sessions that were stored without a namespace into the
+// namespace of the store. Match reports if a key is a session ID, if it is nil
+// all hashes whose key looks like a session ID are moved. Existing sessions in
+// the namespace are not overwritten. It returns the number of moved sessions.
+func (s *RedisStore) Migrate(match func(key string) bool) (int, error) {
+	if s.Prefix == "" {
+		return 0, ErrNoPrefix
+	}
+
+	if match == nil {
+		match = isSessionID
+	}
+
+	count := 0
+	for _, conn := range s.masters() {
+		err := scan(conn, "*", func(key string) error {
+			if strings.HasPrefix(key, s.Prefix) || !match(key) {
+				return nil
+			}
+
+			kind, err := redis.String(conn.Do("TYPE", key))
+			if err != nil || kind != "hash" {
+				return err
+			}
+
+			moved, err := s.migrateKey(conn, key, s.key(key))
+			if moved {
+				count++
+			}
+
+			return err
+		})
+		conn.Close()
+
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// migrateKey renames a key, unless the new key exists already. Keys on
+// different slots of a cluster are moved with DUMP and RESTORE.
+func (s *RedisStore) migrateKey(conn redis.Conn, key, newKey string) (bool, error) {
+	renamed, err := redis.Bool(conn.Do("RENAMENX", key, newKey))
+	if e, ok := err.(redis.Error); !ok || !strings.HasPrefix(e.Error(), "CROSSSLOT") {
+		return renamed, err
+	}
+
+	target := s.conn(newKey)
+	exists, err := redis.Bool(target.Do("EXISTS", newKey))
+	target.Close()
+
+	if err != nil || exists {
+		return false, err
+	}
+
+	return true, s.move(conn, key, newKey)
+}
@@ -0,0 +1,112 @@
+// +build redis
+
+package cookie_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/anihex/server-utils/tools"
+	"github.com/garyburd/redigo/redis"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNamespace(t *testing.T) {
+	Convey("Sessions with a namespace should be kept apart from other keys.", t, func() {
+		server := newFakeServer("127.0.0.1:6379")
+		dial := fakeDialer(server)
+		pool := &redis.Pool{Dial: func() (redis.Conn, error) { return dial(server.addr) }}
+
+		newCookie := cookie.NewRedis(pool, cookie.Namespace("app"))
+		c := roundTrip(t, newCookie)
+		So(c.SetUser("alice"), ShouldBeNil)
+		roundTrip(t, newCookie)
+
+		other := roundTrip(t, cookie.NewRedis(pool, cookie.Namespace("other")))
+
+		So(server.hashes, ShouldContainKey, "app:demo:"+c.GetSessionID())
+		So(server.hashes, ShouldContainKey, "other:demo:"+other.GetSessionID())
+		So(server.sets, ShouldContainKey, "app:demo:sessions:alice")
+
+		store := cookie.NewRedisStore(pool)
+		store.Prefix = cookie.KeyPrefix("app", "demo")
+
+		Convey("The generic constructor should use the namespace as well", func() {
+			generic := roundTrip(t, cookie.New(cookie.NewRedisStore(pool), cookie.Namespace("generic")))
+			So(server.hashes, ShouldContainKey, "generic:demo:"+generic.GetSessionID())
+			So(server.hashes, ShouldNotContainKey, generic.GetSessionID())
+		})
+
+		Convey("Count should only count the sessions of the namespace", func() {
+			count, err := store.Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+
+		Convey("Purge should delete the sessions and the index of the namespace", func() {
+			count, err := store.Purge()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+
+			So(server.hashes, ShouldNotContainKey, "app:demo:"+c.GetSessionID())
+			So(server.sets, ShouldNotContainKey, "app:demo:sessions:alice")
+			So(server.hashes, ShouldContainKey, "other:demo:"+other.GetSessionID())
+		})
+
+		Convey("A store without a prefix should not be purged", func() {
+			_, err := cookie.NewRedisStore(pool).Purge()
+			So(err, ShouldEqual, cookie.ErrNoPrefix)
+		})
+
+		Convey("Migrate should move sessions without a namespace", func() {
+			// Older versions stored the values as they are, without metadata
+			legacy := tools.GID(32)
+			server.hashes[legacy] = map[string][]byte{"name": []byte("demo"), "user_id": []byte("5")}
+			server.hashes["not-a-session"] = map[string][]byte{"name": []byte("demo")}
+			server.sets[tools.GID(32)] = map[string]bool{"member": true}
+
+			count, err := store.Migrate(nil)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			So(server.hashes, ShouldNotContainKey, legacy)
+			So(server.hashes, ShouldContainKey, "app:demo:"+legacy)
+			So(server.hashes, ShouldContainKey, "not-a-session")
+
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&http.Cookie{Name: "demo", Value: legacy})
+
+			migrated, err := newCookie(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(migrated.GetSessionID(), ShouldEqual, legacy)
+			So(migrated.GetString("name"), ShouldEqual, "demo")
+			So(migrated.GetUint64("user_id"), ShouldEqual, 5)
+		})
+	})
+
+	Convey("Migrate should move sessions to other slots of a cluster.", t, func() {
+		cluster := &fakeCluster{split: 8192, nodes: [2]string{"10.0.1.1:7000", "10.0.1.2:7000"}}
+		first := newFakeServer(cluster.nodes[0])
+		second := newFakeServer(cluster.nodes[1])
+		first.cluster, second.cluster = cluster, cluster
+
+		provider := cookie.NewClusterProvider([]string{first.addr}, fakeDialer(first, second))
+
+		for i := 0; i < 10; i++ {
+			roundTrip(t, cookie.NewRedisProvider(provider))
+		}
+
+		store := cookie.NewRedisProviderStore(provider)
+		store.Prefix = cookie.KeyPrefix("app", "demo")
+
+		count, err := store.Migrate(nil)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 10)
+
+		count, err = store.Count()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 10)
+	})
+}
@@ -0,0 +1,533 @@
+package cookie
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// createdField is the field of a session that holds the time the session was
+// created.
+const createdField = "_created"
+
+// ErrInvalidID is returned if a session ID has the wrong length or contains
+// characters that aren't part of the alphabet of tools.GID.
+var ErrInvalidID = errors.New("invalid session id")
+
+// isSessionID reports if a key looks like a session ID. IDs consist of idLength
+// characters of the alphabet of tools.GID. Internal data like the user index
+// or remember-me tokens uses IDs with a ':', so a session cookie can't reach
+// it.
+func isSessionID(key string) bool {
+	if len(key) != idLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newID creates a new session ID using the generator of the options.
+func (o options) newID() (string, error) {
+	id := o.generator(idLength)
+	if !isSessionID(id) {
+		return "", ErrInvalidID
+	}
+
+	return id, nil
+}
+
+// encodeTime converts a time into unix nano seconds. The internal fields of a
+// session don't use the codec, so the store can be read without knowing it.
+func encodeTime(t time.Time) []byte {
+	return []byte(strconv.FormatInt(t.UnixNano(), 10))
+}
+
+// decodeTime reads a time that was stored as unix nano seconds. Invalid values
+// result in the zero time.
+func decodeTime(data []byte) time.Time {
+	result, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, result)
+}
+
+// StoreCookie is a session that keeps it's values in a Store. Only the session
+// ID is sent to the client. A StoreCookie belongs to a single request and is
+// not safe for concurrent use, concurrent requests of a session use their own
+// cookies.
+type StoreCookie struct {
+	getters
+	Cookie    http.Cookie
+	Backend   Store
+	SessionID string
+	stored    bool
+	isNew     bool
+	changed   bool
+	seen      bool
+	created   time.Time
+	opts      options
+	buffer    buffer
+	policy    *FingerprintPolicy
+	err       error
+	w         http.ResponseWriter
+	r         *http.Request
+	name      string
+}
+
+// ttl returns the time the session has left on the server side. A result of 0
+// means the session doesn't expire.
+func (session *StoreCookie) ttl() time.Duration {
+	ttl := session.opts.idleTimeout
+	if session.opts.absoluteTimeout > 0 {
+		left := session.opts.absoluteTimeout - time.Since(session.created)
+		if left <= 0 {
+			return -1
+		}
+
+		if ttl <= 0 || left < ttl {
+			ttl = left
+		}
+	}
+
+	return ttl
+}
+
+// load checks if the session exists in the store and refreshes it's time to
+// live. The result is false if the session is unknown or expired.
+func (session *StoreCookie) load() (bool, error) {
+	data, err := session.getValue(createdField)
+	if err == ErrNotFound {
+		return session.adopt()
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	session.created = decodeTime(data)
+	if session.created.IsZero() {
+		return false, nil
+	}
+
+	if !session.opts.expires() {
+		return true, nil
+	}
+
+	ttl := session.ttl()
+	if ttl < 0 {
+		if err := session.Backend.Destroy(session.SessionID); err != nil {
+			return false, err
+		}
+
+		session.opts.fire(EventExpired, session.r, session.SessionID, "")
+
+		return false, nil
+	}
+
+	// Buffered sessions refresh the time to live when they are stored
+	if session.opts.buffered {
+		session.buffer.refresh = true
+		return true, nil
+	}
+
+	return true, session.Backend.Expire(session.SessionID, ttl)
+}
+
+// adopt takes over a session that was written without the fields of this
+// package, e.g. by an older RedisCookie. It gets the current time as the time
+// it was created, so it expires like a new session. The result is false if
+// the session doesn't exist.
+func (session *StoreCookie) adopt() (bool, error) {
+	exists, err := sessionExists(session.Backend, session.SessionID)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	session.created = time.Now()
+	data := encodeTime(session.created)
+
+	if session.opts.buffered {
+		session.buffer.set(createdField, data)
+		session.buffer.refresh = true
+		return true, nil
+	}
+
+	if err := session.Backend.Set(session.SessionID, createdField, data); err != nil {
+		return false, err
+	}
+
+	if ttl := session.ttl(); ttl > 0 {
+		return true, session.Backend.Expire(session.SessionID, ttl)
+	}
+
+	return true, nil
+}
+
+// getValue reads a value from the buffer or the store.
+func (session *StoreCookie) getValue(Name string) ([]byte, error) {
+	if session.opts.buffered {
+		return session.bufferedValue(Name)
+	}
+
+	return session.Backend.Get(session.SessionID, Name)
+}
+
+// GetCookie returns the http Cookie of the cookie
+func (session *StoreCookie) GetCookie() http.Cookie {
+	return session.Cookie
+}
+
+// GetBackend returns the store of the cookie
+func (session *StoreCookie) GetBackend() Store {
+	return session.Backend
+}
+
+// GetSessionID returns the SessionID of the cookie
+func (session *StoreCookie) GetSessionID() string {
+	return session.SessionID
+}
+
+// GetValue reads a value from the store and returns it
+func (session *StoreCookie) GetValue(Name string) []byte {
+	result, err := session.getValue(Name)
+	if err != nil {
+		return []byte{}
+	}
+
+	return result
+}
+
+// SetValue stores a value in the store. Buffered sessions write the value when
+// they are stored.
+func (session *StoreCookie) SetValue(Name string, Value interface{}) {
+	data, err := encodeValue(session.opts.codec, Value)
+	if err != nil {
+		return
+	}
+	session.changed = true
+
+	if session.opts.buffered {
+		session.buffer.set(Name, data)
+		return
+	}
+
+	session.Backend.Set(session.SessionID, Name, data)
+
+	session.Store()
+}
+
+// SetInterface stores an Interface using the codec of the cookie. Unlike
+// SetValue it encodes byte slices as well.
+func (session *StoreCookie) SetInterface(Name string, Value interface{}) error {
+	ToStore, err := session.opts.codec.Marshal(Value)
+	if err != nil {
+		return err
+	}
+
+	session.SetValue(Name, ToStore)
+
+	return nil
+}
+
+// DeleteValue deletes a value from the store. Buffered sessions delete the
+// value when they are stored.
+func (session *StoreCookie) DeleteValue(Name string) error {
+	if session.opts.buffered {
+		session.buffer.del(Name)
+		return nil
+	}
+
+	if err := session.Backend.Delete(session.SessionID, Name); err != nil {
+		return err
+	}
+
+	session.Store()
+
+	return nil
+}
+
+// take reads a value and deletes it. If the store is a Taker, this happens at
+// once.
+func (session *StoreCookie) take(Name string) ([]byte, error) {
+	if session.opts.buffered {
+		// Values that were changed by this request weren't written yet
+		if value, ok := session.buffer.changed[Name]; ok {
+			session.buffer.del(Name)
+			return value, nil
+		}
+
+		delete(session.buffer.values, Name)
+	}
+
+	if taker, ok := session.Backend.(Taker); ok {
+		return taker.Take(session.SessionID, Name)
+	}
+
+	value, err := session.Backend.Get(session.SessionID, Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, session.Backend.Delete(session.SessionID, Name)
+}
+
+// AddFlash adds a flash message to the given category. It can be read once
+// by Flashes. If the store is an Updater, concurrent requests don't lose
+// messages.
+func (session *StoreCookie) AddFlash(category FlashCategory, message string) error {
+	return appendFlash(session.Update, category, message)
+}
+
+// Flashes returns the flash messages of the given category and deletes them.
+// If the store is a Taker, two requests can't read the same messages.
+func (session *StoreCookie) Flashes(category FlashCategory) ([]string, error) {
+	data, err := session.take(flashField(category))
+
+	return decodeFlashes(session.opts.codec, data, err)
+}
+
+// Remove deletes all entries in the store. It also invalidates the http
+// cookie
+func (session *StoreCookie) Remove(w http.ResponseWriter) {
+	user := session.GetUser()
+	session.Backend.Destroy(session.SessionID)
+	session.reindex(user, session.SessionID, "")
+	session.opts.fire(EventDestroyed, session.r, session.SessionID, "")
+	session.buffer = buffer{}
+	session.SessionID = ""
+	session.Cookie = session.opts.expiredCookie(session.name)
+
+	http.SetCookie(w, &session.Cookie)
+}
+
+// SetSessionID forces a change of the session-ID. The ID has to be a valid
+// session ID, otherwise ErrInvalidID is returned.
+func (session *StoreCookie) SetSessionID(w http.ResponseWriter, id string) error {
+	if !isSessionID(id) {
+		return ErrInvalidID
+	}
+
+	session.Cookie = session.opts.httpCookie(session.name, id, session.created)
+	session.SessionID = id
+
+	http.SetCookie(w, &session.Cookie)
+
+	return nil
+}
+
+// Store saves the http-Cookie if neccessary. Buffered sessions also write all
+// changes to the store. EventSaved is fired once per request, and whenever
+// buffered changes were written. New sessions are only written once they were
+// changed, so requests that don't use the session leave nothing behind.
+func (session *StoreCookie) Store() {
+	if session.isNew && !session.changed {
+		return
+	}
+
+	session.touch()
+	session.create()
+
+	saved := !session.stored
+	if session.opts.buffered {
+		saved = saved || session.buffer.dirty()
+		session.err = session.flush()
+	}
+
+	if !session.stored {
+		c, err := session.r.Cookie(session.name)
+		if err != nil || c.Value != session.Cookie.Value {
+			http.SetCookie(session.w, &session.Cookie)
+		}
+
+		session.stored = true
+	}
+
+	if saved {
+		session.opts.fire(EventSaved, session.r, session.SessionID, "")
+	}
+}
+
+// Err returns the error of the last write of the buffered changes by Store.
+// The changes of a buffered session are lost if it isn't nil.
+func (session *StoreCookie) Err() error {
+	return session.err
+}
+
+// newStoreCookie creates a cookie for a new session.
+func newStoreCookie(w http.ResponseWriter, r *http.Request, Name string, store Store, opts options, policy *FingerprintPolicy) (*StoreCookie, error) {
+	id, err := opts.newID()
+	if err != nil {
+		return &StoreCookie{}, err
+	}
+
+	created := time.Now()
+	c := opts.httpCookie(Name, id, created)
+
+	session := &StoreCookie{
+		Backend:   store,
+		SessionID: c.Value,
+		Cookie:    c,
+		isNew:     true,
+		created:   created,
+		opts:      opts,
+		policy:    policy,
+		w:         w,
+		r:         r,
+		name:      Name,
+	}
+	session.getters = getters{session.getValue, opts.codec}
+
+	return session, nil
+}
+
+// create writes a new session to the store.
+func (session *StoreCookie) create() {
+	if !session.isNew {
+		return
+	}
+
+	data := encodeTime(session.created)
+	session.isNew = false
+
+	if session.opts.buffered {
+		session.buffer.set(createdField, data)
+		session.buffer.refresh = true
+	} else {
+		session.Backend.Set(session.SessionID, createdField, data)
+
+		if ttl := session.ttl(); ttl > 0 {
+			session.Backend.Expire(session.SessionID, ttl)
+		}
+	}
+
+	if session.policy != nil {
+		session.setInternal(fingerprintField, session.policy.fingerprint(session.r))
+	}
+
+	session.opts.fire(EventCreated, session.r, session.SessionID, "")
+}
+
+// Regenerate moves all values of the session to a new, random session ID and
+// re-issues the http cookie. The old ID is invalid afterwards. It should be
+// called whenever the privileges of the session change (e.g. on login) to
+// prevent session fixation.
+func (session *StoreCookie) Regenerate(w http.ResponseWriter) error {
+	id, err := session.opts.newID()
+	if err != nil {
+		return err
+	}
+
+	session.create()
+
+	if session.opts.buffered {
+		if err := session.flush(); err != nil {
+			return err
+		}
+	}
+
+	user := session.GetUser()
+	if err := session.Backend.Rename(session.SessionID, id); err != nil {
+		return err
+	}
+
+	if err := session.reindex(user, session.SessionID, id); err != nil {
+		return err
+	}
+
+	oldID := session.SessionID
+	session.SessionID = id
+	session.Cookie = session.opts.httpCookie(session.name, id, session.created)
+	session.stored = true
+
+	http.SetCookie(w, &session.Cookie)
+	session.opts.fire(EventRotated, session.r, id, oldID)
+
+	return nil
+}
+
+// NewStoreCookie creates a new cookie whose values are kept in the given
+// store. A cookie value that isn't a session ID results in a new session, so
+// clients can't access other data of the store. Session IDs that are unknown
+// to the store or expired result in a new session as well, so clients can't
+// choose their own session ID.
+func NewStoreCookie(w http.ResponseWriter, r *http.Request, Name string, store Store, opts ...Option) (*StoreCookie, error) {
+	if w == nil {
+		return &StoreCookie{}, errors.New("responseWriter not set")
+	}
+
+	if r == nil {
+		return &StoreCookie{}, errors.New("request not set")
+	}
+
+	o := newOptions(opts)
+	if o.namespace != "" {
+		namespacer, ok := store.(Namespacer)
+		if !ok {
+			return &StoreCookie{}, ErrNoNamespace
+		}
+		store = namespacer.Namespaced(o.keyPrefix(Name))
+	}
+
+	policy := o.fingerprintPolicy(Name)
+	Name = o.cookieName(Name)
+
+	cookie, err := r.Cookie(Name)
+	if err != nil || !isSessionID(cookie.Value) {
+		return newStoreCookie(w, r, Name, store, o, policy)
+	}
+
+	result := &StoreCookie{
+		Backend:   store,
+		SessionID: cookie.Value,
+		Cookie:    o.httpCookie(Name, cookie.Value, time.Now()),
+		opts:      o,
+		policy:    policy,
+		w:         w,
+		r:         r,
+		name:      Name,
+	}
+	result.getters = getters{result.getValue, o.codec}
+
+	ok, err := result.load()
+	if err != nil {
+		return &StoreCookie{}, err
+	}
+
+	if !ok {
+		return newStoreCookie(w, r, Name, store, o, policy)
+	}
+	result.Cookie = o.httpCookie(Name, cookie.Value, result.created)
+
+	if policy != nil {
+		ok, err := result.verify(policy)
+		if err != nil {
+			return &StoreCookie{}, err
+		}
+
+		if !ok {
+			return newStoreCookie(w, r, Name, store, o, policy)
+		}
+	}
+
+	o.fire(EventLoaded, r, result.SessionID, "")
+
+	return result, nil
+}
+
+// New returns a CookieFunc that creates cookies whose values are kept in the
+// given store.
+func New(store Store, opts ...Option) CookieFunc {
+	return func(w http.ResponseWriter, r *http.Request, Name string) (Cookie, error) {
+		return NewStoreCookie(w, r, Name, store, opts...)
+	}
+}
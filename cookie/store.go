@@ -0,0 +1,71 @@
+package cookie
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by a Store if the requested value doesn't exist.
+var ErrNotFound = errors.New("value not found")
+
+// ErrNoNamespace is returned if a cookie should use a namespace, but the store
+// can't keep it's keys in one.
+var ErrNoNamespace = errors.New("store has no namespaces")
+
+// Store is the backend that holds the values of the sessions. Every session is
+// a hash of fields which is identified by the session ID.
+type Store interface {
+	// Get returns the value of a field. If the field doesn't exist, ErrNotFound
+	// is returned.
+	Get(id, field string) ([]byte, error)
+	// Set stores the value of a field.
+	Set(id, field string, value []byte) error
+	// Delete removes a field.
+	Delete(id, field string) error
+	// GetAll returns all fields of a session.
+	GetAll(id string) (map[string][]byte, error)
+	// Expire sets the time to live of a session. A ttl of 0 or less makes
+	// the session persistent.
+	Expire(id string, ttl time.Duration) error
+	// Rename moves all fields of a session to a new ID. The old ID doesn't
+	// exist afterwards.
+	Rename(id, newID string) error
+	// Destroy removes a session and all of it's fields.
+	Destroy(id string) error
+}
+
+// Exister is implemented by stores that can tell if a session exists, even if
+// it has none of the fields of this package. Sessions that were written by
+// older versions are adopted this way.
+type Exister interface {
+	// Exists reports if the session has any fields.
+	Exists(id string) (bool, error)
+}
+
+// sessionExists reports if a session exists in the store. Stores that aren't
+// an Exister are asked for all fields of the session.
+func sessionExists(store Store, id string) (bool, error) {
+	if exister, ok := store.(Exister); ok {
+		return exister.Exists(id)
+	}
+
+	values, err := store.GetAll(id)
+
+	return len(values) > 0, err
+}
+
+// Namespacer is implemented by stores that can keep their keys in a namespace.
+// Cookies with the Namespace option use the store returned by Namespaced.
+type Namespacer interface {
+	// Namespaced returns a copy of the store that puts the prefix in front of
+	// all of it's keys.
+	Namespaced(prefix string) Store
+}
+
+// Taker is implemented by stores that can read and delete a field at once. It
+// makes sure that a value, like a flash message, is only read by one request.
+type Taker interface {
+	// Take returns the value of a field and deletes it. If the field doesn't
+	// exist, ErrNotFound is returned.
+	Take(id, field string) ([]byte, error)
+}
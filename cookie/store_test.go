@@ -0,0 +1,252 @@
+package cookie_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryStore(t *testing.T) {
+	Convey("A MemoryStore should behave like a hash per session.", t, func() {
+		store := cookie.NewMemoryStore()
+
+		Convey("Missing values should return ErrNotFound", func() {
+			_, err := store.Get("session", "missing")
+			So(err, ShouldEqual, cookie.ErrNotFound)
+		})
+
+		Convey("Stored values should be returned by Get and GetAll", func() {
+			So(store.Set("session", "name", []byte("demo")), ShouldBeNil)
+
+			value, err := store.Get("session", "name")
+			So(err, ShouldBeNil)
+			So(string(value), ShouldEqual, "demo")
+
+			all, err := store.GetAll("session")
+			So(err, ShouldBeNil)
+			So(all, ShouldResemble, map[string][]byte{"name": []byte("demo")})
+		})
+
+		Convey("Destroy should remove all values of a session", func() {
+			store.Set("session", "name", []byte("demo"))
+			So(store.Destroy("session"), ShouldBeNil)
+
+			all, _ := store.GetAll("session")
+			So(all, ShouldBeEmpty)
+		})
+
+		Convey("Cookies created by New should keep their values in the store", func() {
+			tmpCookie, err := cookie.New(store)(New(t), &http.Request{}, "demo")
+			So(err, ShouldBeNil)
+
+			tmpCookie.SetValue("name", "demo")
+			value, _ := store.Get(tmpCookie.GetSessionID(), "name")
+			So(string(value), ShouldEqual, `"demo"`)
+		})
+	})
+}
+
+func TestTimeouts(t *testing.T) {
+	Convey("Sessions with timeouts should expire on the server side.", t, func() {
+		store := cookie.NewMemoryStore()
+
+		// next sends the session cookie of c with a new request
+		next := func(newCookie cookie.CookieFunc, c cookie.Cookie) cookie.Cookie {
+			httpCookie := c.GetCookie()
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&httpCookie)
+
+			result, err := newCookie(New(t), r, "demo")
+			So(err, ShouldBeNil)
+
+			return result
+		}
+
+		Convey("An unknown session ID should result in a new session", func() {
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour))
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&http.Cookie{Name: "demo", Value: "unknown"})
+
+			tmpCookie, err := newCookie(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(tmpCookie.GetSessionID(), ShouldNotEqual, "unknown")
+		})
+
+		Convey("Using a session should keep it alive", func() {
+			newCookie := cookie.New(store, cookie.IdleTimeout(50*time.Millisecond))
+			tmpCookie, _ := newCookie(New(t), &http.Request{}, "demo")
+			tmpCookie.SetValue("name", "demo")
+
+			for i := 0; i < 3; i++ {
+				time.Sleep(30 * time.Millisecond)
+				nextCookie := next(newCookie, tmpCookie)
+				So(nextCookie.GetSessionID(), ShouldEqual, tmpCookie.GetSessionID())
+			}
+
+			Convey("But an idle session should expire", func() {
+				time.Sleep(70 * time.Millisecond)
+				nextCookie := next(newCookie, tmpCookie)
+				So(nextCookie.GetSessionID(), ShouldNotEqual, tmpCookie.GetSessionID())
+				So(nextCookie.GetString("name"), ShouldEqual, "")
+			})
+		})
+
+		Convey("A session should expire after the absolute timeout even if it's used", func() {
+			newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour), cookie.AbsoluteTimeout(80*time.Millisecond))
+			tmpCookie, _ := newCookie(New(t), &http.Request{}, "demo")
+			tmpCookie.SetValue("name", "demo")
+
+			time.Sleep(40 * time.Millisecond)
+			So(next(newCookie, tmpCookie).GetString("name"), ShouldEqual, "demo")
+
+			time.Sleep(60 * time.Millisecond)
+			So(next(newCookie, tmpCookie).GetString("name"), ShouldEqual, "")
+		})
+	})
+}
+
+func TestRegenerate(t *testing.T) {
+	Convey("Regenerating a session should move it to a new ID.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour))
+
+		w := New(t)
+		tmpCookie, _ := newCookie(w, &http.Request{}, "demo")
+		tmpCookie.SetValue("name", "demo")
+		oldID := tmpCookie.GetSessionID()
+
+		So(tmpCookie.Regenerate(w), ShouldBeNil)
+		So(tmpCookie.GetSessionID(), ShouldNotEqual, oldID)
+		So(tmpCookie.GetCookie().Value, ShouldEqual, tmpCookie.GetSessionID())
+		So(tmpCookie.GetString("name"), ShouldEqual, "demo")
+
+		Convey("The old ID should not be usable anymore", func() {
+			_, err := store.Get(oldID, "name")
+			So(err, ShouldEqual, cookie.ErrNotFound)
+
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&http.Cookie{Name: "demo", Value: oldID})
+			oldCookie, _ := newCookie(New(t), r, "demo")
+			So(oldCookie.GetSessionID(), ShouldNotEqual, oldID)
+			So(oldCookie.GetString("name"), ShouldEqual, "")
+		})
+
+		Convey("A session that wasn't stored yet should be regenerated as well", func() {
+			freshCookie, _ := newCookie(New(t), &http.Request{}, "demo")
+			freshID := freshCookie.GetSessionID()
+
+			So(freshCookie.Regenerate(New(t)), ShouldBeNil)
+			So(freshCookie.GetSessionID(), ShouldNotEqual, freshID)
+
+			_, err := store.Get(freshCookie.GetSessionID(), "_created")
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestLegacySession(t *testing.T) {
+	Convey("Sessions written without metadata should be adopted.", t, func() {
+		store := cookie.NewMemoryStore()
+		legacy := strings.Repeat("l", 32)
+		store.Set(legacy, "user_id", []byte("5"))
+
+		r := &http.Request{Header: make(http.Header)}
+		r.AddCookie(&http.Cookie{Name: "demo", Value: legacy})
+
+		for name, opts := range map[string][]cookie.Option{
+			"unbuffered": {cookie.IdleTimeout(50 * time.Millisecond)},
+			"buffered":   {cookie.IdleTimeout(50 * time.Millisecond), cookie.Buffered()},
+		} {
+			Convey("The "+name+" cookie should keep the ID and the values", func() {
+				tmpCookie, err := cookie.New(store, opts...)(New(t), r, "demo")
+				So(err, ShouldBeNil)
+				So(tmpCookie.GetSessionID(), ShouldEqual, legacy)
+				So(tmpCookie.GetUint64("user_id"), ShouldEqual, 5)
+				tmpCookie.Store()
+
+				_, err = store.Get(legacy, "_created")
+				So(err, ShouldBeNil)
+
+				Convey("And the session should expire like a new one", func() {
+					time.Sleep(70 * time.Millisecond)
+
+					_, err := store.Get(legacy, "user_id")
+					So(err, ShouldEqual, cookie.ErrNotFound)
+				})
+			})
+		}
+	})
+}
+
+func TestStoreNamespace(t *testing.T) {
+	Convey("Stores that can't use a namespace should reject the option.", t, func() {
+		_, err := cookie.New(cookie.NewMemoryStore(), cookie.Namespace("app"))(New(t), &http.Request{}, "demo")
+		So(err, ShouldEqual, cookie.ErrNoNamespace)
+	})
+}
+
+func TestUnknownSessionID(t *testing.T) {
+	Convey("Session IDs that the store doesn't know should start a new session.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store)
+		planted := strings.Repeat("x", 32)
+
+		r := &http.Request{Header: make(http.Header)}
+		r.AddCookie(&http.Cookie{Name: "demo", Value: planted})
+		tmpCookie, err := newCookie(New(t), r, "demo")
+		So(err, ShouldBeNil)
+		So(tmpCookie.GetSessionID(), ShouldNotEqual, planted)
+
+		tmpCookie.SetValue("name", "demo")
+		_, err = store.Get(planted, "_created")
+		So(err, ShouldEqual, cookie.ErrNotFound)
+
+		Convey("Known session IDs should still be loaded", func() {
+			httpCookie := tmpCookie.GetCookie()
+			r := &http.Request{Header: make(http.Header)}
+			r.AddCookie(&httpCookie)
+
+			nextCookie, err := newCookie(New(t), r, "demo")
+			So(err, ShouldBeNil)
+			So(nextCookie.GetSessionID(), ShouldEqual, tmpCookie.GetSessionID())
+			So(nextCookie.GetString("name"), ShouldEqual, "demo")
+		})
+	})
+}
+
+func TestIDGenerator(t *testing.T) {
+	Convey("Session IDs should be created by the configured generator.", t, func() {
+		generator := func(n int) string {
+			return strings.Repeat("a", n)
+		}
+
+		tmpCookie, _ := cookie.New(cookie.NewMemoryStore(), cookie.IDGenerator(generator))(New(t), &http.Request{}, "demo")
+		So(tmpCookie.GetSessionID(), ShouldEqual, strings.Repeat("a", 32))
+
+		Convey("Generators that don't create valid session IDs should be rejected", func() {
+			uuid := func(n int) string {
+				return "123e4567-e89b-12d3-a456-426614174000"
+			}
+
+			_, err := cookie.New(cookie.NewMemoryStore(), cookie.IDGenerator(uuid))(New(t), &http.Request{}, "demo")
+			So(err, ShouldEqual, cookie.ErrInvalidID)
+
+			tmpCookie, _ := cookie.New(cookie.NewMemoryStore())(New(t), &http.Request{}, "demo")
+			So(tmpCookie.SetSessionID(New(t), "123e4567-e89b-12d3-a456-426614174000"), ShouldEqual, cookie.ErrInvalidID)
+			So(tmpCookie.SetSessionID(New(t), strings.Repeat("b", 32)), ShouldBeNil)
+			So(tmpCookie.GetSessionID(), ShouldEqual, strings.Repeat("b", 32))
+		})
+
+		Convey("The default generator should create random IDs of 32 characters", func() {
+			tmpCookie, _ := cookie.New(cookie.NewMemoryStore())(New(t), &http.Request{}, "demo")
+			otherCookie, _ := cookie.New(cookie.NewMemoryStore())(New(t), &http.Request{}, "demo")
+			So(len(tmpCookie.GetSessionID()), ShouldEqual, 32)
+			So(tmpCookie.GetSessionID(), ShouldNotEqual, otherCookie.GetSessionID())
+		})
+	})
+}
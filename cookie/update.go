@@ -0,0 +1,137 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// updateAttempts is the number of times an update is tried before ErrConflict
+// is returned.
+const updateAttempts = 10
+
+// maxBackoff is the longest time backoff waits.
+const maxBackoff = 100 * time.Millisecond
+
+// backoff waits a random time before the next attempt of an update, so
+// concurrent requests don't run into each other again. It grows with every
+// attempt, so the attempts of many requests spread out quickly.
+func backoff(attempt int) {
+	if attempt > 0 {
+		max := time.Millisecond << uint(attempt)
+		if max > maxBackoff {
+			max = maxBackoff
+		}
+
+		time.Sleep(time.Duration(rand.Int63n(int64(max))))
+	}
+}
+
+// ErrConflict is returned by Update if the session was changed by other
+// requests during every attempt.
+var ErrConflict = errors.New("session was changed concurrently")
+
+// Updater is implemented by stores that can change a field without losing the
+// changes of concurrent requests. It is a compare-and-set: the new value is
+// only written if the session wasn't changed since the old value was read.
+type Updater interface {
+	// Update replaces the value of a field with the result of f. Old is nil
+	// if the field doesn't exist. If the session was changed in between, f
+	// is called again with the new value. ErrConflict is returned if the
+	// session kept changing.
+	Update(id, field string, f func(old []byte) ([]byte, error)) error
+}
+
+// updateStore changes a field of a session. Stores that aren't an Updater
+// read and write the field without a check, so concurrent updates may get
+// lost.
+func updateStore(store Store, id, field string, f func(old []byte) ([]byte, error)) error {
+	if updater, ok := store.(Updater); ok {
+		return updater.Update(id, field, f)
+	}
+
+	old, err := store.Get(id, field)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	value, err := f(old)
+	if err != nil {
+		return err
+	}
+
+	return store.Set(id, field, value)
+}
+
+// updateFunc turns the callback of Update into a function that changes the
+// encoded value. The value is reset and decoded before every call of f, so a
+// repeated attempt doesn't see the changes of the one before.
+func updateFunc(codec Codec, Name string, value interface{}, f func(found bool) error) (func([]byte) ([]byte, error), error) {
+	target := reflect.ValueOf(value)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return nil, fmt.Errorf("cookie: Update of %s needs a non-nil pointer", Name)
+	}
+
+	return func(old []byte) ([]byte, error) {
+		target.Elem().Set(reflect.Zero(target.Elem().Type()))
+
+		if old != nil {
+			if err := codec.Unmarshal(old, value); err != nil {
+				return nil, fmt.Errorf("cookie: can't decode %s: %v", Name, err)
+			}
+		}
+
+		if err := f(old != nil); err != nil {
+			return nil, err
+		}
+
+		return codec.Marshal(value)
+	}, nil
+}
+
+// Update changes a value of the session without losing the changes of
+// concurrent requests, e.g. when two requests add an item to a cart. The
+// current value is decoded into value, which has to be a pointer, and found
+// reports if it existed. After f changed value, it is written if the session
+// wasn't changed in between. Otherwise it is decoded again and f is called
+// again, so f must not have other side effects. The store has to be an
+// Updater for this to be safe.
+func (session *StoreCookie) Update(Name string, value interface{}, f func(found bool) error) error {
+	update, err := updateFunc(session.opts.codec, Name, value, f)
+	if err != nil {
+		return err
+	}
+
+	session.create()
+
+	// Buffered changes are written first, so they can't overwrite the update
+	if session.opts.buffered {
+		if err := session.flush(); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	err = updateStore(session.Backend, session.SessionID, Name, func(old []byte) ([]byte, error) {
+		var e error
+		data, e = update(old)
+
+		return data, e
+	})
+	if err != nil {
+		return err
+	}
+
+	if session.opts.buffered {
+		if session.buffer.values != nil {
+			session.buffer.values[Name] = data
+		}
+		return nil
+	}
+
+	session.Store()
+
+	return nil
+}
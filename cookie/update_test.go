@@ -0,0 +1,132 @@
+package cookie_test
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// addItems adds an item to the cart of the session from several requests at
+// the same time. It returns the errors of the requests.
+func addItems(t *testing.T, newCookie cookie.CookieFunc, session cookie.Cookie, n int) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			c, err := newCookie(New(t), withCookie(session), "demo")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			var cart []string
+			errs[i] = c.Update("cart", &cart, func(found bool) error {
+				cart = append(cart, strconv.Itoa(i))
+				runtime.Gosched()
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+func TestUpdate(t *testing.T) {
+	Convey("Update should not lose the changes of concurrent requests.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store, cookie.IdleTimeout(time.Hour))
+
+		c, _ := newCookie(New(t), &http.Request{Header: make(http.Header)}, "demo")
+		c.SetValue("name", "demo")
+		c.Store()
+
+		for _, err := range addItems(t, newCookie, c, 20) {
+			So(err, ShouldBeNil)
+		}
+
+		var cart []string
+		So(c.GetInterface("cart", &cart), ShouldBeNil)
+		So(cart, ShouldHaveLength, 20)
+
+		Convey("found should report if the value existed", func() {
+			var count int
+			var existed []bool
+			update := func(found bool) error {
+				existed = append(existed, found)
+				count++
+				return nil
+			}
+
+			So(c.Update("count", &count, update), ShouldBeNil)
+			So(c.Update("count", &count, update), ShouldBeNil)
+			So(existed, ShouldResemble, []bool{false, true})
+			So(c.GetInt64("count"), ShouldEqual, 2)
+		})
+
+		Convey("A session that keeps changing should return ErrConflict", func() {
+			var attempts int
+			var value int
+			err := c.Update("count", &value, func(bool) error {
+				attempts++
+				store.Set(c.GetSessionID(), "count", []byte(strconv.Itoa(attempts)))
+				return nil
+			})
+
+			So(err, ShouldEqual, cookie.ErrConflict)
+			So(attempts, ShouldEqual, 10)
+		})
+
+		Convey("The value has to be a pointer", func() {
+			var value int
+			So(c.Update("count", value, func(bool) error { return nil }), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Buffered sessions should write the update at once.", t, func() {
+		store := cookie.NewMemoryStore()
+		newCookie := cookie.New(store, cookie.Buffered())
+
+		c, _ := newCookie(New(t), &http.Request{Header: make(http.Header)}, "demo")
+		c.SetValue("name", "demo")
+
+		var count int
+		So(c.Update("count", &count, func(bool) error {
+			count = 5
+			return nil
+		}), ShouldBeNil)
+
+		value, _ := store.Get(c.GetSessionID(), "count")
+		So(string(value), ShouldEqual, "5")
+		So(c.GetString("name"), ShouldEqual, "demo")
+		So(c.GetInt64("count"), ShouldEqual, 5)
+	})
+
+	Convey("Client and dummy cookies should update their values.", t, func() {
+		keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+		client, _ := cookie.NewClient(keys)(New(t), &http.Request{}, "demo")
+		dummy, _ := cookie.NewDummyCookie(map[string]interface{}{"count": int64(1)}, "dummy")(New(t), &http.Request{}, "demo")
+
+		for _, c := range []cookie.Cookie{client, dummy} {
+			var count int64
+			So(c.Update("count", &count, func(bool) error {
+				count++
+				return nil
+			}), ShouldBeNil)
+		}
+
+		So(client.GetInt64("count"), ShouldEqual, 1)
+		So(dummy.GetInt64("count"), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,222 @@
+package cookie
+
+import (
+	"fmt"
+	"time"
+)
+
+// encodeValue converts a value into the form it is stored in. Byte slices are
+// stored as they are, everything else is encoded with the codec so the typed
+// getters can read it back.
+func encodeValue(codec Codec, value interface{}) ([]byte, error) {
+	if v, ok := value.([]byte); ok {
+		return v, nil
+	}
+
+	return codec.Marshal(value)
+}
+
+// getters implements the typed getters of a Cookie on top of a function that
+// returns the raw value of a field. The function returns ErrNotFound if the
+// field doesn't exist. The values are decoded with the codec.
+type getters struct {
+	lookup func(string) ([]byte, error)
+	codec  Codec
+}
+
+// value returns the raw value of a field. Missing values and errors result in
+// an empty value.
+func (g getters) value(Name string) []byte {
+	value, err := g.lookup(Name)
+	if err != nil {
+		return []byte{}
+	}
+
+	return value
+}
+
+// decode reads a value and binds it to the target. The result reports if
+// the value was found.
+func (g getters) decode(Name string, target interface{}) (bool, error) {
+	value, err := g.lookup(Name)
+	if err == ErrNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if err := g.codec.Unmarshal(value, target); err != nil {
+		return true, fmt.Errorf("cookie: can't decode %s: %v", Name, err)
+	}
+
+	return true, nil
+}
+
+// GetUint64 reads a value and returs it as uint64
+func (g getters) GetUint64(Name string) uint64 {
+	result, _, _ := g.LookupUint64(Name)
+	return result
+}
+
+// GetBool reads a value and returns it as bool
+func (g getters) GetBool(Name string) bool {
+	result, _, _ := g.LookupBool(Name)
+	return result
+}
+
+// GetInt64 reads a value and returns it as int64
+func (g getters) GetInt64(Name string) int64 {
+	result, _, _ := g.LookupInt64(Name)
+	return result
+}
+
+// GetString reads a value and returs it as string. Byte slices are stored as
+// they are by SetValue, so values that aren't encoded strings are returned as
+// they are stored.
+func (g getters) GetString(Name string) string {
+	value, err := g.lookup(Name)
+	if err != nil {
+		return ""
+	}
+
+	var result string
+	if err := g.codec.Unmarshal(value, &result); err != nil {
+		return string(value)
+	}
+
+	return result
+}
+
+// GetInterface reads a value and binds it to the o interface
+func (g getters) GetInterface(Name string, o interface{}) error {
+	return g.codec.Unmarshal(g.value(Name), o)
+}
+
+// GetUint64Array reads a value and returns it as uint64 array
+func (g getters) GetUint64Array(Name string) []uint64 {
+	result, _, _ := g.LookupUint64Array(Name)
+	return result
+}
+
+// GetFloat64 reads a value and returns it as float64
+func (g getters) GetFloat64(Name string) float64 {
+	result, _, _ := g.LookupFloat64(Name)
+	return result
+}
+
+// GetTime reads a value and returns it as time.Time
+func (g getters) GetTime(Name string) time.Time {
+	result, _, _ := g.LookupTime(Name)
+	return result
+}
+
+// GetDuration reads a value and returns it as time.Duration
+func (g getters) GetDuration(Name string) time.Duration {
+	result, _, _ := g.LookupDuration(Name)
+	return result
+}
+
+// GetStringArray reads a value and returns it as string array
+func (g getters) GetStringArray(Name string) []string {
+	result, _, _ := g.LookupStringArray(Name)
+	return result
+}
+
+// GetInt64Array reads a value and returns it as int64 array
+func (g getters) GetInt64Array(Name string) []int64 {
+	result, _, _ := g.LookupInt64Array(Name)
+	return result
+}
+
+// LookupString reads a value and returns it as string. It also reports if the
+// value was found. Values that aren't encoded strings, like byte slices that
+// were stored as they are, return an error. GetValue reads them instead.
+func (g getters) LookupString(Name string) (string, bool, error) {
+	var result string
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupUint64 reads a value and returns it as uint64. It also reports if the
+// value was found.
+func (g getters) LookupUint64(Name string) (uint64, bool, error) {
+	var result uint64
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupInt64 reads a value and returns it as int64. It also reports if the
+// value was found.
+func (g getters) LookupInt64(Name string) (int64, bool, error) {
+	var result int64
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupBool reads a value and returns it as bool. It also reports if the
+// value was found.
+func (g getters) LookupBool(Name string) (bool, bool, error) {
+	var result bool
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupFloat64 reads a value and returns it as float64. It also reports if
+// the value was found.
+func (g getters) LookupFloat64(Name string) (float64, bool, error) {
+	var result float64
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupTime reads a value and returns it as time.Time. It also reports if the
+// value was found.
+func (g getters) LookupTime(Name string) (time.Time, bool, error) {
+	var result time.Time
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupDuration reads a value and returns it as time.Duration. It also
+// reports if the value was found.
+func (g getters) LookupDuration(Name string) (time.Duration, bool, error) {
+	var result time.Duration
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupUint64Array reads a value and returns it as uint64 array. It also
+// reports if the value was found.
+func (g getters) LookupUint64Array(Name string) ([]uint64, bool, error) {
+	var result []uint64
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupInt64Array reads a value and returns it as int64 array. It also
+// reports if the value was found.
+func (g getters) LookupInt64Array(Name string) ([]int64, bool, error) {
+	var result []int64
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
+
+// LookupStringArray reads a value and returns it as string array. It also
+// reports if the value was found.
+func (g getters) LookupStringArray(Name string) ([]string, bool, error) {
+	var result []string
+	found, err := g.decode(Name, &result)
+
+	return result, found, err
+}
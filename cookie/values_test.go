@@ -0,0 +1,130 @@
+package cookie_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// failingStore is a store whose reads always fail.
+type failingStore struct {
+	*cookie.MemoryStore
+}
+
+func (s failingStore) Get(id, field string) ([]byte, error) {
+	return nil, errors.New("store is down")
+}
+
+func TestLookup(t *testing.T) {
+	keys := []cookie.KeyPair{{HashKey: []byte("01234567890123456789012345678901")}}
+	backends := map[string]cookie.CookieFunc{
+		"memory": cookie.NewMemory(nil),
+		"client": cookie.NewClient(keys),
+		"dummy":  cookie.NewDummyCookie(make(map[string]interface{}), "dummy"),
+	}
+
+	for name, newCookie := range backends {
+		Convey("The Lookup methods of the "+name+" cookie should tell missing, zero and invalid values apart.", t, func() {
+			tmpCookie, _ := newCookie(New(t), &http.Request{}, "demo")
+			now := time.Now().Round(0)
+
+			tmpCookie.SetValue("zero", 0)
+			tmpCookie.SetValue("float", 1.5)
+			tmpCookie.SetValue("time", now)
+			tmpCookie.SetValue("duration", time.Hour)
+			tmpCookie.SetValue("strings", []string{"a", "b"})
+			tmpCookie.SetValue("ints", []int64{-1, 2})
+			tmpCookie.SetValue("text", "text")
+
+			Convey("Missing values should not be found", func() {
+				value, found, err := tmpCookie.LookupUint64("missing")
+				So(value, ShouldEqual, 0)
+				So(found, ShouldBeFalse)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Zero values should be found", func() {
+				value, found, err := tmpCookie.LookupInt64("zero")
+				So(value, ShouldEqual, 0)
+				So(found, ShouldBeTrue)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Invalid values should return an error", func() {
+				_, found, err := tmpCookie.LookupBool("text")
+				So(found, ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+
+				_, found, err = tmpCookie.LookupString("float")
+				So(found, ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("All types should be readable", func() {
+				f, _, err := tmpCookie.LookupFloat64("float")
+				So(err, ShouldBeNil)
+				So(f, ShouldEqual, 1.5)
+				So(tmpCookie.GetFloat64("float"), ShouldEqual, 1.5)
+
+				tm, _, err := tmpCookie.LookupTime("time")
+				So(err, ShouldBeNil)
+				So(tm.Equal(now), ShouldBeTrue)
+				So(tmpCookie.GetTime("time").Equal(now), ShouldBeTrue)
+
+				d, _, err := tmpCookie.LookupDuration("duration")
+				So(err, ShouldBeNil)
+				So(d, ShouldEqual, time.Hour)
+				So(tmpCookie.GetDuration("duration"), ShouldEqual, time.Hour)
+
+				strs, _, err := tmpCookie.LookupStringArray("strings")
+				So(err, ShouldBeNil)
+				So(strs, ShouldResemble, []string{"a", "b"})
+				So(tmpCookie.GetStringArray("strings"), ShouldResemble, []string{"a", "b"})
+
+				ints, _, err := tmpCookie.LookupInt64Array("ints")
+				So(err, ShouldBeNil)
+				So(ints, ShouldResemble, []int64{-1, 2})
+				So(tmpCookie.GetInt64Array("ints"), ShouldResemble, []int64{-1, 2})
+
+				text, found, err := tmpCookie.LookupString("text")
+				So(err, ShouldBeNil)
+				So(found, ShouldBeTrue)
+				So(text, ShouldEqual, "text")
+			})
+
+			Convey("Plain Go values should be readable by the Get methods", func() {
+				tmpCookie.SetValue("int", 1)
+				tmpCookie.SetValue("bool", true)
+				tmpCookie.SetValue("uints", []int{1, 2})
+
+				value, found, err := tmpCookie.LookupUint64("int")
+				So(err, ShouldBeNil)
+				So(found, ShouldBeTrue)
+				So(value, ShouldEqual, 1)
+				So(tmpCookie.GetUint64("int"), ShouldEqual, 1)
+				So(tmpCookie.GetInt64("int"), ShouldEqual, 1)
+				So(tmpCookie.GetBool("bool"), ShouldBeTrue)
+				So(tmpCookie.GetString("text"), ShouldEqual, "text")
+				So(tmpCookie.GetUint64Array("uints"), ShouldResemble, []uint64{1, 2})
+
+				var target []int64
+				So(tmpCookie.GetInterface("uints", &target), ShouldBeNil)
+				So(target, ShouldResemble, []int64{1, 2})
+			})
+		})
+	}
+
+	Convey("Errors of the store should be returned by the Lookup methods.", t, func() {
+		tmpCookie, _ := cookie.New(failingStore{cookie.NewMemoryStore()})(New(t), &http.Request{}, "demo")
+
+		_, found, err := tmpCookie.LookupString("name")
+		So(found, ShouldBeFalse)
+		So(err, ShouldNotBeNil)
+		So(tmpCookie.GetString("name"), ShouldEqual, "")
+	})
+}
@@ -4,7 +4,9 @@ go 1.12
 
 require (
 	github.com/anihex/json v0.0.0
+	github.com/fxamacker/cbor v1.5.1
 	github.com/garyburd/redigo v1.6.0
 	github.com/pebbe/zmq4 v1.0.0
 	github.com/smartystreets/goconvey v0.0.0-20190330032615-68dc04aab96a
+	github.com/vmihailenco/msgpack v4.0.4+incompatible
 )
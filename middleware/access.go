@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+// AccessLogFormat is the line format of AccessLog.
+type AccessLogFormat int
+
+// The formats of AccessLog.
+const (
+	// CommonLog is the Common Log Format of the Apache HTTP Server, followed
+	// by the latency in milliseconds and the quoted request ID.
+	CommonLog AccessLogFormat = iota
+	// CombinedLog is the Common Log Format with referer and user agent,
+	// followed by the latency in milliseconds and the quoted request ID.
+	CombinedLog
+	// JSONLog writes a JSON object per line. It contains all fields,
+	// including the latency and the request ID.
+	JSONLog
+)
+
+// clfTime is the time format of the Common Log Format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogConfig configures AccessLog.
+type AccessLogConfig struct {
+	// Format is the line format, the default is CommonLog.
+	Format AccessLogFormat
+	// Output receives the lines. Without it the entries are passed to the
+	// package logger: JSONLog passes the fields, the other formats pass the
+	// line as the message.
+	Output io.Writer
+	// SkipPaths are path prefixes that aren't logged, e.g. "/status".
+	SkipPaths []string
+	// Skip decides about requests that shouldn't be logged after the
+	// response was sent.
+	Skip func(r *http.Request, status int) bool
+	// SampleRate is the share of successful requests that is logged, e.g.
+	// 0.1 for every tenth. Responses with a status of 400 or more are always
+	// logged. 0 logs every request.
+	SampleRate float64
+	// RequestID returns the ID of the request. The default uses the ID of the
+	// RequestID middleware, if it runs after AccessLog the one of the
+	// response. Without the middleware a valid ID in the header of the
+	// request is used.
+	RequestID func(w http.ResponseWriter, r *http.Request) string
+}
+
+// accessWriter records the status and the size of a response.
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+// WriteHeader records the status and writes the header.
+func (aw *accessWriter) WriteHeader(status int) {
+	if aw.status == 0 {
+		aw.status = status
+	}
+	aw.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the body and writes it.
+func (aw *accessWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+
+	n, err := aw.ResponseWriter.Write(b)
+	aw.size += int64(n)
+
+	return n, err
+}
+
+// Flush flushes the response, if the underlying ResponseWriter supports it.
+func (aw *accessWriter) Flush() {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+
+	if f, ok := aw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection, e.g. for websockets. The response is
+// logged with "101 Switching Protocols". It fails if the underlying
+// ResponseWriter doesn't support it.
+func (aw *accessWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := aw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: ResponseWriter doesn't support hijacking")
+	}
+
+	if aw.status == 0 {
+		aw.status = http.StatusSwitchingProtocols
+	}
+
+	return h.Hijack()
+}
+
+// Push starts a HTTP/2 server push, if the underlying ResponseWriter supports
+// it.
+func (aw *accessWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := aw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// accessEntry holds the fields of a line of the access log.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	RemoteIP  string    `json:"remote_ip"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Latency   float64   `json:"latency_ms"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// startTime returns the time that was stored by the Time middleware. Without
+// it the given time is used.
+func startTime(r *http.Request, now time.Time) time.Time {
+	if start, ok := r.Context().Value(timeKey).(time.Time); ok {
+		return start
+	}
+
+	return now
+}
+
+// defaultRequestID returns the ID of the RequestID middleware or reads it from
+// the headers. IDs from the headers are checked like the ones of RequestID.
+func defaultRequestID(w http.ResponseWriter, r *http.Request) string {
+	if id := GetRequestID(r); id != "" {
+		return id
+	}
+
+	for _, id := range []string{w.Header().Get(RequestIDHeader), r.Header.Get(RequestIDHeader)} {
+		if validRequestID(id) {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// clfField returns a field of the Common Log Format, "-" if it is empty.
+func clfField(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// fields returns the fields of the entry for a structured logger. The time is
+// added by the logger.
+func (e *accessEntry) fields() []tools.Field {
+	fields := []tools.Field{
+		tools.F("remote_ip", e.RemoteIP),
+		tools.F("method", e.Method),
+		tools.F("uri", e.URI),
+		tools.F("proto", e.Proto),
+		tools.F("status", e.Status),
+		tools.F("bytes", e.Bytes),
+		tools.F("latency_ms", e.Latency),
+	}
+
+	optional := []tools.Field{
+		tools.F("user", e.User),
+		tools.F("referer", e.Referer),
+		tools.F("user_agent", e.UserAgent),
+		tools.F("request_id", e.RequestID),
+	}
+
+	for _, f := range optional {
+		if f.Value != "" {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// format converts the entry into a line of the given format.
+func (e *accessEntry) format(f AccessLogFormat) []byte {
+	if f == JSONLog {
+		data, _ := json.Marshal(e)
+		return append(data, '\n')
+	}
+
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+
+	request := strconv.Quote(e.Method + " " + e.URI + " " + e.Proto)
+	line := clfField(e.RemoteIP) + " - " + clfField(e.User) + " [" + e.Time.Format(clfTime) + "] " +
+		request + " " + strconv.Itoa(e.Status) + " " + size
+
+	if f == CombinedLog {
+		line += " " + strconv.Quote(clfField(e.Referer)) + " " + strconv.Quote(clfField(e.UserAgent))
+	}
+
+	// Like %D of Apache, parsers of the formats can skip these fields
+	line += " " + strconv.FormatFloat(e.Latency, 'f', 3, 64) + " " + strconv.Quote(clfField(e.RequestID))
+
+	return []byte(line + "\n")
+}
+
+// AccessLog logs every response with it's status, size and latency. The
+// latency starts at the time stored by the Time middleware, if it runs
+// before. Unlike Log it writes the line after the handler returned.
+func AccessLog(config AccessLogConfig) func(f http.HandlerFunc) http.HandlerFunc {
+	requestID := config.RequestID
+	if requestID == nil {
+		requestID = defaultRequestID
+	}
+
+	var mu sync.Mutex
+
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range config.SkipPaths {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					f(w, r)
+					return
+				}
+			}
+
+			start := startTime(r, time.Now())
+			aw := &accessWriter{ResponseWriter: w}
+
+			f(aw, r)
+
+			status := aw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if config.Skip != nil && config.Skip(r, status) {
+				return
+			}
+
+			if config.SampleRate > 0 && status < 400 && rand.Float64() >= config.SampleRate {
+				return
+			}
+
+			user, _, _ := r.BasicAuth()
+			uri := r.RequestURI
+			if uri == "" {
+				uri = r.URL.RequestURI()
+			}
+
+			entry := &accessEntry{
+				Time:      start,
+				RemoteIP:  tools.ClientIP(r),
+				User:      user,
+				Method:    r.Method,
+				URI:       uri,
+				Proto:     r.Proto,
+				Status:    status,
+				Bytes:     aw.size,
+				Latency:   float64(time.Since(start)) / float64(time.Millisecond),
+				Referer:   r.Referer(),
+				UserAgent: r.UserAgent(),
+				RequestID: requestID(w, r),
+			}
+
+			if config.Output == nil {
+				if logger == nil {
+					return
+				}
+
+				// The logger adds the ID of the context itself
+				if GetRequestID(r) != "" {
+					entry.RequestID = ""
+				}
+
+				level := tools.StatusLevel(status)
+				if config.Format == JSONLog {
+					logger.Log(r.Context(), level, "access", entry.fields()...)
+				} else {
+					line := entry.format(config.Format)
+					logger.Log(r.Context(), level, string(line[:len(line)-1]))
+				}
+
+				return
+			}
+
+			mu.Lock()
+			config.Output.Write(entry.format(config.Format))
+			mu.Unlock()
+		}
+	}
+}
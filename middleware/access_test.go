@@ -0,0 +1,260 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/middleware"
+	"github.com/anihex/server-utils/tools"
+)
+
+func TestAccessLogCapture(t *testing.T) {
+	tt := []struct {
+		Name    string
+		Handler http.HandlerFunc
+		Status  int
+		Bytes   int64
+	}{
+		{
+			Name: "status and body",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("hello"))
+				w.Write([]byte(" world"))
+			},
+			Status: http.StatusCreated,
+			Bytes:  11,
+		},
+		{
+			Name: "body without status",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			Status: http.StatusOK,
+			Bytes:  5,
+		},
+		{
+			Name:    "no response",
+			Handler: func(w http.ResponseWriter, r *http.Request) {},
+			Status:  http.StatusOK,
+		},
+		{
+			Name: "error",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "not found", http.StatusNotFound)
+			},
+			Status: http.StatusNotFound,
+			Bytes:  10,
+		},
+	}
+
+	for _, tc := range tt {
+		var buf bytes.Buffer
+		h := middleware.AccessLog(middleware.AccessLogConfig{Format: middleware.JSONLog, Output: &buf})(tc.Handler)
+		h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		var entry struct {
+			Status int   `json:"status"`
+			Bytes  int64 `json:"bytes"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Errorf("case %s failed. %v", tc.Name, err)
+			continue
+		}
+
+		if entry.Status != tc.Status || entry.Bytes != tc.Bytes {
+			t.Errorf("case %s failed. %d and %d bytes expected, got %d and %d bytes", tc.Name, tc.Status, tc.Bytes, entry.Status, entry.Bytes)
+		}
+	}
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, "abc")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}
+
+	clf := `^192\.0\.2\.1 - alice \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /users\?id=\\"5\\" HTTP/1\.1" 201 5`
+
+	tt := []struct {
+		Name   string
+		Format middleware.AccessLogFormat
+		Result *regexp.Regexp
+	}{
+		{
+			Name:   "common",
+			Format: middleware.CommonLog,
+			Result: regexp.MustCompile(clf + ` \d+\.\d{3} "abc"\n$`),
+		},
+		{
+			Name:   "combined",
+			Format: middleware.CombinedLog,
+			Result: regexp.MustCompile(clf + ` "https://example\.com/" "test \\"agent\\"" \d+\.\d{3} "abc"\n$`),
+		},
+		{
+			Name:   "JSON",
+			Format: middleware.JSONLog,
+			Result: regexp.MustCompile(`^\{"time":"[^"]+","remote_ip":"192\.0\.2\.1","user":"alice","method":"POST","uri":"/users\?id=\\"5\\"","proto":"HTTP/1\.1","status":201,"bytes":5,"latency_ms":[\d.e-]+,"referer":"https://example\.com/","user_agent":"test \\"agent\\"","request_id":"abc"\}\n$`),
+		},
+	}
+
+	for _, tc := range tt {
+		var buf bytes.Buffer
+		h := middleware.AccessLog(middleware.AccessLogConfig{Format: tc.Format, Output: &buf})(handler)
+
+		r := httptest.NewRequest("POST", `/users?id="5"`, nil)
+		r.SetBasicAuth("alice", "secret")
+		r.Header.Set("Referer", "https://example.com/")
+		r.Header.Set("User-Agent", `test "agent"`)
+		h(httptest.NewRecorder(), r)
+
+		if !tc.Result.MatchString(buf.String()) {
+			t.Errorf("case %s failed. got %q", tc.Name, buf.String())
+		}
+	}
+}
+
+func TestAccessLogSkip(t *testing.T) {
+	var buf bytes.Buffer
+	h := middleware.AccessLog(middleware.AccessLogConfig{
+		Output:    &buf,
+		SkipPaths: []string{"/status"},
+		Skip: func(r *http.Request, status int) bool {
+			return status == http.StatusNotModified
+		},
+	})(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cached" {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	})
+
+	tt := []struct {
+		Path   string
+		Logged bool
+	}{
+		{Path: "/", Logged: true},
+		{Path: "/status", Logged: false},
+		{Path: "/status/db", Logged: false},
+		{Path: "/cached", Logged: false},
+	}
+
+	for _, tc := range tt {
+		buf.Reset()
+		h(httptest.NewRecorder(), httptest.NewRequest("GET", tc.Path, nil))
+
+		if logged := buf.Len() > 0; logged != tc.Logged {
+			t.Errorf("path %s: logged %v expected, got %v", tc.Path, tc.Logged, logged)
+		}
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	status := http.StatusOK
+	h := middleware.AccessLog(middleware.AccessLogConfig{Output: &buf, SampleRate: 0.2})(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+
+	for i := 0; i < 1000; i++ {
+		h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	// About 200 lines, with a generous margin for the randomness
+	if lines := strings.Count(buf.String(), "\n"); lines < 100 || lines > 300 {
+		t.Errorf("about 200 of 1000 lines expected, got %d", lines)
+	}
+
+	buf.Reset()
+	status = http.StatusInternalServerError
+	for i := 0; i < 100; i++ {
+		h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 100 {
+		t.Errorf("all errors should be logged, got %d of 100", lines)
+	}
+}
+
+func TestAccessLogLatency(t *testing.T) {
+	var buf bytes.Buffer
+
+	// The latency starts at the Time middleware, even if it runs long before
+	wait := func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+			f(w, r)
+		}
+	}
+
+	chain := middleware.NewChain(
+		middleware.Time,
+		wait,
+		middleware.AccessLog(middleware.AccessLogConfig{Output: &buf}),
+	)
+	chain.Then(okHandler)(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	fields := strings.Fields(buf.String())
+	latency, err := strconv.ParseFloat(fields[len(fields)-2], 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latency < 20 {
+		t.Errorf("latency of at least 20ms expected, got %v", latency)
+	}
+}
+
+func TestAccessLogLogger(t *testing.T) {
+	logger := &tools.RecordLogger{}
+	middleware.SetLogger(logger)
+	defer middleware.SetLog(tools.DefaultLogger)
+
+	h := middleware.AccessLog(middleware.AccessLogConfig{Format: middleware.JSONLog})(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	h = middleware.AccessLog(middleware.AccessLogConfig{})(okHandler)
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if len(logger.Entries()) != 2 {
+		t.Fatalf("2 entries expected, got %d", len(logger.Entries()))
+	}
+
+	entry := logger.Entries()[0]
+	if entry.Msg != "access" || entry.Level != tools.LevelWarn || entry.Fields["status"] != http.StatusNotFound || entry.Fields["uri"] != "/missing" {
+		t.Errorf("JSONLog should pass the fields, got %+v", entry)
+	}
+
+	entry = logger.Entries()[1]
+	if !strings.Contains(entry.Msg, `"GET / HTTP/1.1" 200`) || !strings.HasSuffix(entry.Msg, ` "-"`) || len(entry.Fields) != 0 {
+		t.Errorf("CommonLog should pass the line, got %+v", entry)
+	}
+}
+
+func TestAccessLogHijack(t *testing.T) {
+	var buf bytes.Buffer
+	h := middleware.AccessLog(middleware.AccessLogConfig{Format: middleware.JSONLog, Output: &buf})(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatalf("hijack failed: %v", err)
+		}
+		conn.Close()
+	})
+
+	hr := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h(hr, httptest.NewRequest("GET", "/ws", nil))
+
+	if !hr.hijacked || !strings.Contains(buf.String(), `"status":101`) {
+		t.Errorf("hijacked connections should be logged with 101, got %s", buf.String())
+	}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps a handler. All middleware of this package has this
+// signature, so it can be used in a Chain.
+type Middleware func(f http.HandlerFunc) http.HandlerFunc
+
+// Chain is an ordered stack of middleware. The first middleware is the
+// outermost one, it sees the request first. Chains are immutable, Append and
+// Extend return new chains, so a chain can be shared by several routes.
+type Chain struct {
+	middleware []Middleware
+}
+
+// NewChain creates a chain of the given middleware.
+func NewChain(m ...Middleware) Chain {
+	return Chain{}.Append(m...)
+}
+
+// Append returns a new chain with the middleware added to the end.
+func (c Chain) Append(m ...Middleware) Chain {
+	result := make([]Middleware, 0, len(c.middleware)+len(m))
+	result = append(result, c.middleware...)
+	result = append(result, m...)
+
+	return Chain{middleware: result}
+}
+
+// Extend returns a new chain with the middleware of the other chain added to
+// the end.
+func (c Chain) Extend(other Chain) Chain {
+	return c.Append(other.middleware...)
+}
+
+// Then wraps the handler with the middleware of the chain. A nil handler uses
+// http.DefaultServeMux.
+func (c Chain) Then(f http.HandlerFunc) http.HandlerFunc {
+	if f == nil {
+		f = http.DefaultServeMux.ServeHTTP
+	}
+
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		f = c.middleware[i](f)
+	}
+
+	return f
+}
+
+// ThenHandler wraps a http.Handler with the middleware of the chain. A nil
+// handler uses http.DefaultServeMux.
+func (c Chain) ThenHandler(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+
+	return c.Then(h.ServeHTTP)
+}
+
+// Middleware returns the chain as a single middleware, e.g. for routers that
+// take a list of middleware like Vestigo.
+func (c Chain) Middleware() func(f http.HandlerFunc) http.HandlerFunc {
+	return c.Then
+}
+
+// If uses the middleware only for requests that match the predicate. Other
+// requests go straight to the handler.
+func If(match func(r *http.Request) bool, m Middleware) func(f http.HandlerFunc) http.HandlerFunc {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		wrapped := m(f)
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			if match(r) {
+				wrapped(w, r)
+				return
+			}
+
+			f(w, r)
+		}
+	}
+}
+
+// Unless uses the middleware only for requests that don't match the
+// predicate.
+func Unless(match func(r *http.Request) bool, m Middleware) func(f http.HandlerFunc) http.HandlerFunc {
+	return If(func(r *http.Request) bool { return !match(r) }, m)
+}
+
+// IfPathPrefix uses the middleware for requests below the path. "/api"
+// matches "/api" and "/api/users", but not "/apis". A prefix that ends with a
+// slash matches like strings.HasPrefix.
+func IfPathPrefix(prefix string, m Middleware) func(f http.HandlerFunc) http.HandlerFunc {
+	return If(func(r *http.Request) bool {
+		path := r.URL.Path
+		if strings.HasSuffix(prefix, "/") {
+			return strings.HasPrefix(path, prefix)
+		}
+
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	}, m)
+}
+
+// IfMethod uses the middleware for requests with one of the given methods.
+func IfMethod(m Middleware, methods ...string) func(f http.HandlerFunc) http.HandlerFunc {
+	allowed := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		allowed[strings.ToUpper(method)] = true
+	}
+
+	return If(func(r *http.Request) bool {
+		return allowed[r.Method]
+	}, m)
+}
+
+// FromHandler adapts middleware for http.Handler, like most middleware for
+// net/http, so it can be used in a Chain.
+func FromHandler(m func(http.Handler) http.Handler) func(f http.HandlerFunc) http.HandlerFunc {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return m(f).ServeHTTP
+	}
+}
+
+// ToHandler adapts middleware of this package for http.Handler, e.g. to wrap
+// a http.ServeMux.
+func ToHandler(m Middleware) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return m(h.ServeHTTP)
+	}
+}
@@ -0,0 +1,153 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anihex/server-utils/middleware"
+)
+
+// tag returns a middleware that adds the name to the X-Trace header before
+// and after the handler.
+func tag(name string) middleware.Middleware {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			f(w, r)
+			w.Header().Add("X-Trace", "/"+name)
+		}
+	}
+}
+
+// trace runs the handler and returns the X-Trace header.
+func trace(h http.HandlerFunc, method, path string) []string {
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(method, path, nil))
+
+	return w.Header()["X-Trace"]
+}
+
+// handlerTag is a handler that adds "handler" to the X-Trace header.
+func handlerTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("X-Trace", "handler")
+}
+
+func TestChain(t *testing.T) {
+	base := middleware.NewChain(tag("a"), tag("b"))
+	appended := base.Append(tag("c"))
+	extended := base.Extend(middleware.NewChain(tag("d")))
+
+	tt := []struct {
+		Name   string
+		Chain  middleware.Chain
+		Result []string
+	}{
+		{Name: "empty", Chain: middleware.NewChain(), Result: []string{"handler"}},
+		{Name: "order", Chain: base, Result: []string{"a", "b", "handler", "/b", "/a"}},
+		{Name: "Append", Chain: appended, Result: []string{"a", "b", "c", "handler", "/c", "/b", "/a"}},
+		{Name: "Extend", Chain: extended, Result: []string{"a", "b", "d", "handler", "/d", "/b", "/a"}},
+	}
+
+	for _, tc := range tt {
+		if result := trace(tc.Chain.Then(handlerTag), "GET", "/"); !reflect.DeepEqual(result, tc.Result) {
+			t.Errorf("case %s failed. %v expected, got %v", tc.Name, tc.Result, result)
+		}
+
+		h := tc.Chain.Middleware()(handlerTag)
+		if result := trace(h, "GET", "/"); !reflect.DeepEqual(result, tc.Result) {
+			t.Errorf("case %s failed with Middleware. %v expected, got %v", tc.Name, tc.Result, result)
+		}
+	}
+
+	// Append and Extend must not change the chain they were called on
+	shared := middleware.NewChain(tag("a"), tag("b"), tag("c")).Append()
+	first := shared.Append(tag("x"))
+	second := shared.Append(tag("y"))
+
+	if result := trace(first.Then(handlerTag), "GET", "/"); strings.Join(result, ",") != "a,b,c,x,handler,/x,/c,/b,/a" {
+		t.Errorf("chains shouldn't share their middleware, got %v", result)
+	}
+
+	if result := trace(second.Then(handlerTag), "GET", "/"); strings.Join(result, ",") != "a,b,c,y,handler,/y,/c,/b,/a" {
+		t.Errorf("chains shouldn't share their middleware, got %v", result)
+	}
+}
+
+// registerOnce registers the handler of TestChainDefaultServeMux, the test can
+// run more than once.
+var registerOnce sync.Once
+
+func TestChainDefaultServeMux(t *testing.T) {
+	registerOnce.Do(func() { http.HandleFunc("/chain-test", handlerTag) })
+	chain := middleware.NewChain(tag("a"))
+
+	expected := []string{"a", "handler", "/a"}
+	if result := trace(chain.Then(nil), "GET", "/chain-test"); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Then(nil): %v expected, got %v", expected, result)
+	}
+
+	w := httptest.NewRecorder()
+	chain.ThenHandler(nil).ServeHTTP(w, httptest.NewRequest("GET", "/chain-test", nil))
+	if result := w.Header()["X-Trace"]; !reflect.DeepEqual(result, expected) {
+		t.Errorf("ThenHandler(nil): %v expected, got %v", expected, result)
+	}
+}
+
+func TestChainConditions(t *testing.T) {
+	isAPI := func(r *http.Request) bool { return strings.HasPrefix(r.URL.Path, "/api") }
+
+	tt := []struct {
+		Name       string
+		Middleware middleware.Middleware
+		Method     string
+		Path       string
+		Used       bool
+	}{
+		{Name: "If match", Middleware: middleware.If(isAPI, tag("m")), Method: "GET", Path: "/api/users", Used: true},
+		{Name: "If no match", Middleware: middleware.If(isAPI, tag("m")), Method: "GET", Path: "/", Used: false},
+		{Name: "Unless match", Middleware: middleware.Unless(isAPI, tag("m")), Method: "GET", Path: "/api", Used: false},
+		{Name: "Unless no match", Middleware: middleware.Unless(isAPI, tag("m")), Method: "GET", Path: "/", Used: true},
+		{Name: "IfPathPrefix exact", Middleware: middleware.IfPathPrefix("/api", tag("m")), Method: "GET", Path: "/api", Used: true},
+		{Name: "IfPathPrefix below", Middleware: middleware.IfPathPrefix("/api", tag("m")), Method: "GET", Path: "/api/users", Used: true},
+		{Name: "IfPathPrefix other segment", Middleware: middleware.IfPathPrefix("/api", tag("m")), Method: "GET", Path: "/apis", Used: false},
+		{Name: "IfPathPrefix with slash", Middleware: middleware.IfPathPrefix("/api/", tag("m")), Method: "GET", Path: "/api", Used: false},
+		{Name: "IfMethod match", Middleware: middleware.IfMethod(tag("m"), "post", "DELETE"), Method: "POST", Path: "/", Used: true},
+		{Name: "IfMethod no match", Middleware: middleware.IfMethod(tag("m"), "post", "DELETE"), Method: "GET", Path: "/", Used: false},
+	}
+
+	for _, tc := range tt {
+		expected := []string{"handler"}
+		if tc.Used {
+			expected = []string{"m", "handler", "/m"}
+		}
+
+		h := middleware.NewChain(tc.Middleware).Then(handlerTag)
+		if result := trace(h, tc.Method, tc.Path); !reflect.DeepEqual(result, expected) {
+			t.Errorf("case %s failed. %v expected, got %v", tc.Name, expected, result)
+		}
+	}
+}
+
+func TestChainAdapters(t *testing.T) {
+	handlerMiddleware := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", "std")
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	h := middleware.NewChain(middleware.FromHandler(handlerMiddleware), tag("a")).Then(handlerTag)
+	if result := trace(h, "GET", "/"); strings.Join(result, ",") != "std,a,handler,/a" {
+		t.Errorf("FromHandler: got %v", result)
+	}
+
+	w := httptest.NewRecorder()
+	middleware.ToHandler(tag("a"))(http.HandlerFunc(handlerTag)).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if result := w.Header()["X-Trace"]; strings.Join(result, ",") != "a,handler,/a" {
+		t.Errorf("ToHandler: got %v", result)
+	}
+}
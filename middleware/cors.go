@@ -1,27 +1,300 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
+
+	"github.com/anihex/server-utils/views"
 )
 
-// CORS adds CORS headers to a request
-func CORS(Origins string, MaxAge int, Credentials bool, Methods string) func(f http.HandlerFunc) http.HandlerFunc {
-	cred := "false"
-	if Credentials {
-		cred = "true"
+// defaultCORSMethods are the methods that are allowed if none are configured.
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// CORSConfig configures CORSHandler. Origins are allowed if they match one of
+// the AllowedOrigins, one of the OriginPatterns or if AllowOrigin returns
+// true.
+type CORSConfig struct {
+	// AllowedOrigins are exact origins like "https://example.com", wildcard
+	// subdomains like "https://*.example.com" or "*" for every origin.
+	AllowedOrigins []string
+	// OriginPatterns are regular expressions that have to match the whole
+	// origin.
+	OriginPatterns []*regexp.Regexp
+	// AllowOrigin decides about origins that aren't matched by the lists.
+	AllowOrigin func(r *http.Request, origin string) bool
+	// AllowedMethods are the methods of preflighted requests. The default is
+	// GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers of preflighted requests. "*"
+	// allows every header.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that scripts can read.
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies and authentication. It
+	// can't be used with "*", that would grant every website access to the
+	// data of the users.
+	AllowCredentials bool
+	// MaxAge is the number of seconds a preflight may be cached.
+	MaxAge int
+	// AllowPrivateNetwork allows public websites to access the private
+	// network the server is running in.
+	AllowPrivateNetwork bool
+	// OptionsPassthrough passes preflights on to the handler instead of
+	// answering them.
+	OptionsPassthrough bool
+}
+
+// corsPolicy is a CORSConfig that was prepared for matching.
+type corsPolicy struct {
+	CORSConfig
+	anyOrigin  bool
+	origins    map[string]bool
+	wildcards  [][2]string
+	methods    map[string]bool
+	anyHeader  bool
+	headers    map[string]bool
+	allMethods string
+	exposed    string
+}
+
+// newCORSPolicy prepares a config. Origins and headers are case-insensitive,
+// methods are not. It panics if every origin is allowed with credentials.
+func newCORSPolicy(c CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		CORSConfig: c,
+		origins:    make(map[string]bool),
+		methods:    make(map[string]bool),
+		headers:    make(map[string]bool),
+		exposed:    strings.Join(c.ExposedHeaders, ", "),
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		// Origins never end with a slash, but URLs are often used by mistake
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+
+		switch i := strings.Index(origin, "*"); {
+		case origin == "*":
+			p.anyOrigin = true
+		case i >= 0:
+			p.wildcards = append(p.wildcards, [2]string{origin[:i], origin[i+1:]})
+		case origin != "":
+			p.origins[origin] = true
+		}
+	}
+
+	methods := c.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+
+	for _, method := range methods {
+		p.methods[strings.TrimSpace(method)] = true
+	}
+	p.allMethods = strings.Join(methods, ", ")
+
+	for _, header := range c.AllowedHeaders {
+		header = strings.TrimSpace(header)
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	if p.anyOrigin && p.AllowCredentials {
+		panic(`middleware: CORS can't allow credentials for every origin ("*")`)
+	}
+
+	return p
+}
+
+// allowed reports if the origin may access the resource.
+func (p *corsPolicy) allowed(r *http.Request, origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	if p.origins[lower] {
+		return true
+	}
+
+	for _, w := range p.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+
+	for _, pattern := range p.OriginPatterns {
+		if loc := pattern.FindStringIndex(origin); loc != nil && loc[0] == 0 && loc[1] == len(origin) {
+			return true
+		}
+	}
+
+	return p.AllowOrigin != nil && p.AllowOrigin(r, origin)
+}
+
+// allowOrigin sets the headers that grant the origin access. "*" is never
+// used with credentials, see newCORSPolicy.
+func (p *corsPolicy) allowOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// splitHeaders splits a comma separated list of header names.
+func splitHeaders(list string) []string {
+	var result []string
+	for _, header := range strings.Split(list, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			result = append(result, http.CanonicalHeaderKey(header))
+		}
+	}
+
+	return result
+}
+
+// preflight answers a preflight request. The requested method and headers
+// have to be allowed, otherwise the request is answered with ERR_FORBIDDEN.
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request, origin string) bool {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if p.AllowPrivateNetwork {
+		h.Add("Vary", "Access-Control-Request-Private-Network")
+	}
+
+	if !p.allowed(r, origin) {
+		views.AccessDeniedWithErr(w, r, errors.New("CORS origin not allowed: "+origin))
+		return false
+	}
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !p.methods[method] {
+		views.AccessDeniedWithErr(w, r, errors.New("CORS method not allowed: "+method))
+		return false
+	}
+
+	headers := splitHeaders(r.Header.Get("Access-Control-Request-Headers"))
+	if !p.anyHeader {
+		for _, header := range headers {
+			if !p.headers[header] {
+				views.AccessDeniedWithErr(w, r, errors.New("CORS header not allowed: "+header))
+				return false
+			}
+		}
+	}
+
+	private := r.Header.Get("Access-Control-Request-Private-Network") == "true"
+	if private && !p.AllowPrivateNetwork {
+		views.AccessDeniedWithErr(w, r, errors.New("CORS private network access not allowed"))
+		return false
+	}
+
+	p.allowOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", p.allMethods)
+
+	// The requested headers are reflected, "*" doesn't work with credentials
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(p.MaxAge))
+	}
+
+	if private {
+		h.Set("Access-Control-Allow-Private-Network", "true")
 	}
-	mage := strconv.Itoa(MaxAge)
+
+	return true
+}
+
+// CORSHandler handles cross-origin requests as described by the Fetch
+// standard. Allowed origins are reflected with "Vary: Origin", so caches keep
+// the responses of different origins apart. Preflights are answered with "204
+// No Content" unless OptionsPassthrough is set; disallowed preflights with
+// ERR_FORBIDDEN. Other requests always reach the handler, the browser hides
+// the response from disallowed origins. It panics if the config allows
+// credentials for "*".
+func CORSHandler(config CORSConfig) func(f http.HandlerFunc) http.HandlerFunc {
+	p := newCORSPolicy(config)
 
 	return func(f http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", Origins)
-			w.Header().Set("Access-Control-Max-Age", mage)
-			w.Header().Set("Access-Control-Allow-Credentials", cred)
-			w.Header().Set("Access-Control-Allow-Methods", Methods)
-			w.Header().Set("Access-Control-Allow-Headers", "*")
+			origin := r.Header.Get("Origin")
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if origin != "" && preflight {
+				if !p.preflight(w, r, origin) {
+					return
+				}
+
+				if !p.OptionsPassthrough {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+
+				f(w, r)
+				return
+			}
+
+			// With "*" the response doesn't depend on the origin
+			if !p.anyOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if origin != "" && p.allowed(r, origin) {
+				p.allowOrigin(w.Header(), origin)
+
+				if p.exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", p.exposed)
+				}
+			}
 
 			f(w, r)
 		}
 	}
 }
+
+// CORS adds CORS headers for the given origins. Origins and Methods are comma
+// separated lists, "*" allows every origin. Every request header is allowed.
+// Credentials are ignored with "*", like browsers always did. See CORSHandler
+// for more options.
+func CORS(Origins string, MaxAge int, Credentials bool, Methods string) func(f http.HandlerFunc) http.HandlerFunc {
+	origins := strings.Split(Origins, ",")
+	for _, origin := range origins {
+		if strings.TrimSpace(origin) == "*" {
+			Credentials = false
+		}
+	}
+
+	return CORSHandler(CORSConfig{
+		AllowedOrigins:   origins,
+		AllowedMethods:   splitMethods(Methods),
+		AllowedHeaders:   []string{"*"},
+		AllowCredentials: Credentials,
+		MaxAge:           MaxAge,
+	})
+}
+
+// splitMethods splits a comma separated list of methods.
+func splitMethods(list string) []string {
+	var result []string
+	for _, method := range strings.Split(list, ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			result = append(result, strings.ToUpper(method))
+		}
+	}
+
+	return result
+}
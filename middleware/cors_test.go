@@ -0,0 +1,200 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anihex/server-utils/middleware"
+)
+
+// okHandler answers every request with "200 OK".
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestCORSHandler(t *testing.T) {
+	cors := middleware.CORSHandler(middleware.CORSConfig{
+		AllowedOrigins:   []string{"https://example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type"},
+		ExposedHeaders:   []string{"X-Total-Count"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})(okHandler)
+
+	tt := []struct {
+		Name    string
+		Method  string
+		Headers map[string]string
+		Status  int
+		Result  map[string]string
+	}{
+		{
+			Name:    "simple request",
+			Method:  "GET",
+			Headers: map[string]string{"Origin": "https://example.com"},
+			Status:  http.StatusOK,
+			Result: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total-Count",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			Name:    "wildcard subdomain",
+			Method:  "GET",
+			Headers: map[string]string{"Origin": "https://api.example.org"},
+			Status:  http.StatusOK,
+			Result:  map[string]string{"Access-Control-Allow-Origin": "https://api.example.org"},
+		},
+		{
+			Name:    "disallowed origin",
+			Method:  "GET",
+			Headers: map[string]string{"Origin": "https://evil.com"},
+			Status:  http.StatusOK,
+			Result: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			Name:   "preflight",
+			Method: "OPTIONS",
+			Headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "DELETE",
+				"Access-Control-Request-Headers": "content-type",
+			},
+			Status: http.StatusNoContent,
+			Result: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, POST, DELETE",
+				"Access-Control-Allow-Headers":     "Content-Type",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			Name:   "preflight of a disallowed origin",
+			Method: "OPTIONS",
+			Headers: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			Status: http.StatusForbidden,
+			Result: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			Name:   "preflight of a disallowed method",
+			Method: "OPTIONS",
+			Headers: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			Status: http.StatusForbidden,
+			Result: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			Name:   "preflight of a disallowed header",
+			Method: "OPTIONS",
+			Headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			Status: http.StatusForbidden,
+			Result: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+	}
+
+	for _, tc := range tt {
+		r := httptest.NewRequest(tc.Method, "/", nil)
+		for key, value := range tc.Headers {
+			r.Header.Set(key, value)
+		}
+
+		w := httptest.NewRecorder()
+		cors(w, r)
+
+		if w.Code != tc.Status {
+			t.Errorf("case %s failed. status %d expected, got %d", tc.Name, tc.Status, w.Code)
+		}
+
+		for key, value := range tc.Result {
+			if result := w.Header().Get(key); result != value {
+				t.Errorf("case %s failed. %s: '%s' expected, got '%s'", tc.Name, key, value, result)
+			}
+		}
+
+		if tc.Status == http.StatusForbidden && !strings.Contains(w.Body.String(), "ERR_FORBIDDEN") {
+			t.Errorf("case %s failed. ERR_FORBIDDEN expected, got %s", tc.Name, w.Body.String())
+		}
+	}
+}
+
+func TestCORSWildcardCredentials(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("CORSHandler should panic for credentials with every origin")
+			}
+		}()
+
+		middleware.CORSHandler(middleware.CORSConfig{
+			AllowedOrigins:   []string{"*"},
+			AllowCredentials: true,
+		})
+	}()
+
+	// The legacy shortcut ignores the credentials instead
+	cors := middleware.CORS("*", 600, true, "GET")(okHandler)
+
+	tt := []struct {
+		Name    string
+		Method  string
+		Headers map[string]string
+		Status  int
+	}{
+		{
+			Name:    "simple request",
+			Method:  "GET",
+			Headers: map[string]string{"Origin": "https://evil.com"},
+			Status:  http.StatusOK,
+		},
+		{
+			Name:   "preflight",
+			Method: "OPTIONS",
+			Headers: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			Status: http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range tt {
+		r := httptest.NewRequest(tc.Method, "/", nil)
+		for key, value := range tc.Headers {
+			r.Header.Set(key, value)
+		}
+
+		w := httptest.NewRecorder()
+		cors(w, r)
+
+		if w.Code != tc.Status {
+			t.Errorf("case %s failed. status %d expected, got %d", tc.Name, tc.Status, w.Code)
+		}
+
+		if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+			t.Errorf("case %s failed. '*' expected, got '%s'", tc.Name, origin)
+		}
+
+		if credentials := w.Header().Get("Access-Control-Allow-Credentials"); credentials != "" {
+			t.Errorf("case %s failed. no credentials expected, got '%s'", tc.Name, credentials)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/anihex/server-utils/views"
+)
+
+const (
+	// csrfField is the session field that holds the CSRF secret.
+	csrfField = "_csrf"
+	// csrfLength is the length of a CSRF secret in bytes.
+	csrfLength = 32
+)
+
+// CSRFHeader is the header that carries the CSRF token.
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRFFormField is the form field that carries the CSRF token.
+const CSRFFormField = "csrf_token"
+
+// safeMethods are the methods that don't need a CSRF token.
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// newCSRFSecret creates a new, random CSRF secret.
+func newCSRFSecret() ([]byte, error) {
+	secret := make([]byte, csrfLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// maskCSRF masks the secret with a random one time pad. Every token looks
+// different, so the secret can't be recovered by compression attacks like
+// BREACH.
+func maskCSRF(secret []byte) string {
+	token := make([]byte, 2*len(secret))
+	pad := token[:len(secret)]
+	rand.Read(pad)
+
+	for i := range secret {
+		token[len(secret)+i] = pad[i] ^ secret[i]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// validCSRF checks if the token matches the secret. The token can either be
+// masked or the plain secret.
+func validCSRF(secret []byte, token string) bool {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return false
+	}
+
+	if len(data) == 2*csrfLength {
+		pad, masked := data[:csrfLength], data[csrfLength:]
+		for i := range masked {
+			masked[i] ^= pad[i]
+		}
+		data = masked
+	}
+
+	return len(data) == csrfLength && subtle.ConstantTimeCompare(data, secret) == 1
+}
+
+// checkCSRF reads the token from the header or the form and validates it on
+// unsafe methods.
+func checkCSRF(r *http.Request, secret []byte) error {
+	if safeMethods[r.Method] {
+		return nil
+	}
+
+	token := r.Header.Get(CSRFHeader)
+	if token == "" {
+		token = r.PostFormValue(CSRFFormField)
+	}
+
+	if token == "" {
+		return errors.New("CSRF token missing")
+	}
+
+	if !validCSRF(secret, token) {
+		return errors.New("CSRF token invalid")
+	}
+
+	return nil
+}
+
+// CSRF protects against cross site request forgery. The secret is stored in
+// the session, so it has to be used after the Session middleware. Requests
+// with unsafe methods have to send a token from CSRFToken in the X-CSRF-Token
+// header or the csrf_token form field. Invalid requests are answered with
+// ERR_CSRF.
+func CSRF(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := GetSession(r)
+		if session == nil {
+			views.ServerErrorWithErr(w, r, errors.New("CSRF requires a session"))
+			return
+		}
+
+		secret, err := base64.RawURLEncoding.DecodeString(session.GetString(csrfField))
+		if err != nil || len(secret) != csrfLength {
+			secret, err = newCSRFSecret()
+			if views.ServerErrorIfErr(w, r, err) {
+				return
+			}
+
+			session.SetValue(csrfField, base64.RawURLEncoding.EncodeToString(secret))
+		}
+
+		if views.CSRFIfErr(w, r, checkCSRF(r, secret)) {
+			return
+		}
+
+		f(w, r.WithContext(context.WithValue(r.Context(), csrfKey, secret)))
+	}
+}
+
+// CSRFDoubleSubmit protects against cross site request forgery without a
+// session. The secret is stored in a cookie with the given name, which is
+// readable by JavaScript. Requests with unsafe methods have to send the value
+// of the cookie or a token from CSRFToken in the X-CSRF-Token header or the
+// csrf_token form field.
+func CSRFDoubleSubmit(CookieName string) func(f http.HandlerFunc) http.HandlerFunc {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var secret []byte
+
+			if c, err := r.Cookie(CookieName); err == nil {
+				secret, _ = base64.RawURLEncoding.DecodeString(c.Value)
+			}
+
+			if len(secret) != csrfLength {
+				var err error
+				secret, err = newCSRFSecret()
+				if views.ServerErrorIfErr(w, r, err) {
+					return
+				}
+
+				http.SetCookie(w, &http.Cookie{
+					Name:     CookieName,
+					Value:    base64.RawURLEncoding.EncodeToString(secret),
+					Path:     "/",
+					Secure:   r.TLS != nil,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			if views.CSRFIfErr(w, r, checkCSRF(r, secret)) {
+				return
+			}
+
+			f(w, r.WithContext(context.WithValue(r.Context(), csrfKey, secret)))
+		}
+	}
+}
+
+// CSRFToken returns a masked CSRF token for the request. Every call returns a
+// different token. The result is empty if neither CSRF nor CSRFDoubleSubmit
+// was used.
+func CSRFToken(r *http.Request) string {
+	secret, ok := r.Context().Value(csrfKey).([]byte)
+	if !ok {
+		return ""
+	}
+
+	return maskCSRF(secret)
+}
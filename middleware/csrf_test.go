@@ -0,0 +1,180 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/anihex/server-utils/middleware"
+)
+
+// csrfClient sends requests through the CSRF middleware and keeps the cookies
+// like a browser.
+type csrfClient struct {
+	handler http.HandlerFunc
+	cookies map[string]*http.Cookie
+	token   string
+}
+
+// newCSRFClient creates a client for the handler. The last middleware of the
+// chain is wrapped around capture.
+func newCSRFClient(chain middleware.Chain) *csrfClient {
+	c := &csrfClient{cookies: make(map[string]*http.Cookie)}
+	c.handler = chain.Then(c.capture)
+
+	return c
+}
+
+// capture keeps the CSRF token of the request.
+func (c *csrfClient) capture(w http.ResponseWriter, r *http.Request) {
+	c.token = middleware.CSRFToken(r)
+	w.WriteHeader(http.StatusOK)
+}
+
+// do sends the request with the cookies of the client and keeps the cookies
+// of the response.
+func (c *csrfClient) do(r *http.Request) *httptest.ResponseRecorder {
+	for _, cookie := range c.cookies {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	c.handler(w, r)
+
+	for _, cookie := range w.Result().Cookies() {
+		c.cookies[cookie.Name] = cookie
+	}
+
+	return w
+}
+
+// postRequest creates an unsafe request with the token in the header or the
+// form.
+func postRequest(header, form string) *http.Request {
+	values := url.Values{}
+	if form != "" {
+		values.Set(middleware.CSRFFormField, form)
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if header != "" {
+		r.Header.Set(middleware.CSRFHeader, header)
+	}
+
+	return r
+}
+
+func TestCSRF(t *testing.T) {
+	store := cookie.NewMemoryStore()
+	chain := middleware.NewChain(middleware.Session(cookie.New(store), "demo"), middleware.CSRF)
+
+	client := newCSRFClient(chain)
+	other := newCSRFClient(chain)
+
+	if w := client.do(httptest.NewRequest("GET", "/", nil)); w.Code != http.StatusOK {
+		t.Fatalf("GET should pass, got %d", w.Code)
+	}
+
+	if client.cookies["demo"] == nil || client.token == "" {
+		t.Fatal("GET should create the session and the token")
+	}
+
+	token := client.token
+	other.do(httptest.NewRequest("GET", "/", nil))
+
+	tt := []struct {
+		Name   string
+		Header string
+		Form   string
+		Status int
+	}{
+		{Name: "no token", Status: http.StatusForbidden},
+		{Name: "masked header token", Header: token, Status: http.StatusOK},
+		{Name: "masked form token", Form: token, Status: http.StatusOK},
+		{Name: "invalid token", Header: "invalid", Status: http.StatusForbidden},
+		{Name: "token of another session", Header: other.token, Status: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		w := client.do(postRequest(tc.Header, tc.Form))
+		if w.Code != tc.Status {
+			t.Errorf("case %s failed. status %d expected, got %d", tc.Name, tc.Status, w.Code)
+		}
+
+		if tc.Status == http.StatusForbidden && !strings.Contains(w.Body.String(), "ERR_CSRF") {
+			t.Errorf("case %s failed. ERR_CSRF expected, got %s", tc.Name, w.Body.String())
+		}
+	}
+}
+
+func TestCSRFWithoutSession(t *testing.T) {
+	w := httptest.NewRecorder()
+	middleware.CSRF(okHandler)(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d expected, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	client := newCSRFClient(middleware.NewChain(middleware.CSRFDoubleSubmit("csrf")))
+
+	client.do(httptest.NewRequest("GET", "/", nil))
+
+	secret := client.cookies["csrf"]
+	if secret == nil || secret.HttpOnly {
+		t.Fatalf("GET should set a cookie that is readable by JavaScript, got %v", secret)
+	}
+
+	tt := []struct {
+		Name   string
+		Header string
+		Form   string
+		Status int
+	}{
+		{Name: "no token", Status: http.StatusForbidden},
+		{Name: "value of the cookie", Header: secret.Value, Status: http.StatusOK},
+		{Name: "masked header token", Header: client.token, Status: http.StatusOK},
+		{Name: "masked form token", Form: client.token, Status: http.StatusOK},
+		{Name: "invalid token", Header: "invalid", Status: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		w := client.do(postRequest(tc.Header, tc.Form))
+		if w.Code != tc.Status {
+			t.Errorf("case %s failed. status %d expected, got %d", tc.Name, tc.Status, w.Code)
+		}
+
+		if tc.Status == http.StatusForbidden && !strings.Contains(w.Body.String(), "ERR_CSRF") {
+			t.Errorf("case %s failed. ERR_CSRF expected, got %s", tc.Name, w.Body.String())
+		}
+	}
+}
+
+func TestCSRFTokenMasking(t *testing.T) {
+	var tokens []string
+	client := newCSRFClient(middleware.NewChain(middleware.CSRFDoubleSubmit("csrf")))
+	client.handler = middleware.CSRFDoubleSubmit("csrf")(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, middleware.CSRFToken(r), middleware.CSRFToken(r))
+	})
+
+	client.do(httptest.NewRequest("GET", "/", nil))
+
+	if tokens[0] == tokens[1] {
+		t.Fatalf("every token should look different, got %s twice", tokens[0])
+	}
+
+	for _, token := range tokens[:2] {
+		if w := client.do(postRequest(token, "")); w.Code != http.StatusOK {
+			t.Errorf("token %s should be valid, got %d", token, w.Code)
+		}
+	}
+
+	if token := middleware.CSRFToken(httptest.NewRequest("GET", "/", nil)); token != "" {
+		t.Errorf("no token expected without the middleware, got %s", token)
+	}
+}
@@ -0,0 +1,11 @@
+package middleware
+
+// ctxID is the type of the context keys of the package.
+type ctxID int
+
+// The context keys of the middleware.
+const (
+	sessionKey ctxID = iota
+	csrfKey
+	requestIDKey
+)
@@ -10,10 +10,12 @@ import (
 // Log logs the requests. It uses the package logger to log.
 func Log(f http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if !strings.HasPrefix(r.RequestURI, "/status") && lg != nil {
-			ip := tools.GetIP(r)
-
-			lg.Printf("[%7s] [%s] %s", r.Method, ip, r.RequestURI)
+		if !strings.HasPrefix(r.RequestURI, "/status") && logger != nil {
+			logger.Log(r.Context(), tools.LevelInfo, "request",
+				tools.F("method", r.Method),
+				tools.F("uri", r.RequestURI),
+				tools.F("remote_ip", tools.ClientIP(r)),
+			)
 		}
 
 		f(w, r)
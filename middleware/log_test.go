@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anihex/server-utils/middleware"
+	"github.com/anihex/server-utils/tools"
+)
+
+func TestLog(t *testing.T) {
+	defer middleware.SetLog(tools.DefaultLogger)
+
+	var buf bytes.Buffer
+	middleware.SetLog(log.New(&buf, "", 0))
+
+	tt := []struct {
+		Name   string
+		URI    string
+		Logged bool
+	}{
+		{Name: "request", URI: "/items", Logged: true},
+		{Name: "status", URI: "/status", Logged: false},
+	}
+
+	for _, tc := range tt {
+		buf.Reset()
+
+		r := httptest.NewRequest("GET", tc.URI, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		middleware.Log(okHandler)(httptest.NewRecorder(), r)
+
+		if !tc.Logged {
+			if buf.Len() != 0 {
+				t.Errorf("case %s failed. nothing should be logged, got %q", tc.Name, buf.String())
+			}
+			continue
+		}
+
+		for _, part := range []string{"level=INFO", "msg=request", "method=GET", "uri=" + tc.URI, "remote_ip=192.0.2.1"} {
+			if !strings.Contains(buf.String(), part) {
+				t.Errorf("case %s failed. %s expected in %q", tc.Name, part, buf.String())
+			}
+		}
+	}
+
+	// Nil disables logging, the handler is still called
+	middleware.SetLog(nil)
+
+	called := false
+	middleware.Log(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+
+	if !called {
+		t.Error("the handler should be called")
+	}
+}
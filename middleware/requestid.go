@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+// RequestIDHeader is the header that holds the ID of a request.
+const RequestIDHeader = "X-Request-ID"
+
+// Limits of a request ID that is sent by the client. Longer IDs are replaced,
+// so clients can't flood the logs.
+const (
+	requestIDLength    = 20
+	maxRequestIDLength = 128
+)
+
+// validRequestID reports if an ID of the client can be used. Only letters,
+// digits and "-_.:" are allowed, so the ID can't break the log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequestID gives every request an ID. A valid ID in the X-Request-ID header
+// of the request is used, e.g. from a proxy, otherwise a new one is generated.
+// The ID is sent back in the same header and added to the log fields of the
+// context, so every log entry of the views and the middleware contains it.
+// It should be the first middleware, the ones before it log without the ID.
+func RequestID(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = tools.SecureGID(requestIDLength)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = tools.WithFields(ctx, tools.F("request_id", id))
+
+		f(w, r.WithContext(ctx))
+	}
+}
+
+// GetRequestID returns the ID that was added to the request by the RequestID
+// middleware. The result is empty if there is no ID.
+func GetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+
+	return id
+}
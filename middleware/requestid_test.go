@@ -0,0 +1,171 @@
+package middleware_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anihex/server-utils/middleware"
+	"github.com/anihex/server-utils/tools"
+	"github.com/anihex/server-utils/views"
+)
+
+func TestRequestID(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Header string
+		Kept   bool
+	}{
+		{Name: "no ID", Header: "", Kept: false},
+		{Name: "valid ID", Header: "abc-123_x.y:z", Kept: true},
+		{Name: "UUID", Header: "3f1b7c9e-2d4a-4e8b-9c1f-7a6d5e4b3c2a", Kept: true},
+		{Name: "space", Header: "abc 123", Kept: false},
+		{Name: "quote", Header: `abc"123`, Kept: false},
+		{Name: "too long", Header: strings.Repeat("a", 129), Kept: false},
+		{Name: "longest", Header: strings.Repeat("a", 128), Kept: true},
+	}
+
+	for _, tc := range tt {
+		var id string
+		h := middleware.RequestID(func(w http.ResponseWriter, r *http.Request) {
+			id = middleware.GetRequestID(r)
+		})
+
+		r := httptest.NewRequest("GET", "/", nil)
+		if tc.Header != "" {
+			r.Header.Set(middleware.RequestIDHeader, tc.Header)
+		}
+
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if tc.Kept && id != tc.Header {
+			t.Errorf("case %s failed. '%s' expected, got '%s'", tc.Name, tc.Header, id)
+		}
+
+		if !tc.Kept && (id == tc.Header || len(id) != 20) {
+			t.Errorf("case %s failed. a new ID expected, got '%s'", tc.Name, id)
+		}
+
+		if echoed := w.Header().Get(middleware.RequestIDHeader); echoed != id {
+			t.Errorf("case %s failed. the ID should be sent back, got '%s'", tc.Name, echoed)
+		}
+	}
+
+	if id := middleware.GetRequestID(httptest.NewRequest("GET", "/", nil)); id != "" {
+		t.Errorf("no ID expected without the middleware, got %s", id)
+	}
+}
+
+func TestRequestIDLogs(t *testing.T) {
+	logger := &tools.RecordLogger{}
+	middleware.SetLogger(logger)
+	views.SetLogger(logger)
+	defer middleware.SetLog(tools.DefaultLogger)
+	defer views.SetLogger(nil)
+
+	chain := middleware.NewChain(
+		middleware.RequestID,
+		middleware.Log,
+		middleware.AccessLog(middleware.AccessLogConfig{Format: middleware.JSONLog}),
+	)
+
+	h := chain.Then(func(w http.ResponseWriter, r *http.Request) {
+		views.ServerErrorWithErr(w, r, errors.New("boom"))
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(middleware.RequestIDHeader, "abc")
+	h(httptest.NewRecorder(), r)
+
+	messages := []string{"request", "response", "access"}
+	if len(logger.Entries()) != len(messages) {
+		t.Fatalf("%d entries expected, got %d", len(messages), len(logger.Entries()))
+	}
+
+	for i, entry := range logger.Entries() {
+		if entry.Msg != messages[i] || entry.Fields["request_id"] != "abc" {
+			t.Errorf("entry %s should contain the ID, got %+v", messages[i], entry)
+		}
+	}
+}
+
+func TestAccessLogRequestID(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Chain  func(config middleware.AccessLogConfig) middleware.Chain
+		Header string
+		Result string
+	}{
+		{
+			Name: "valid header",
+			Chain: func(config middleware.AccessLogConfig) middleware.Chain {
+				return middleware.NewChain(middleware.AccessLog(config))
+			},
+			Header: "abc",
+			Result: `"request_id":"abc"`,
+		},
+		{
+			Name: "invalid header",
+			Chain: func(config middleware.AccessLogConfig) middleware.Chain {
+				return middleware.NewChain(middleware.AccessLog(config))
+			},
+			Header: "abc\"}, {\"forged\": 1",
+			Result: "",
+		},
+		{
+			Name: "RequestID after AccessLog",
+			Chain: func(config middleware.AccessLogConfig) middleware.Chain {
+				return middleware.NewChain(middleware.AccessLog(config), middleware.RequestID)
+			},
+			Header: "abc",
+			Result: `"request_id":"abc"`,
+		},
+	}
+
+	for _, tc := range tt {
+		var buf bytes.Buffer
+		config := middleware.AccessLogConfig{Format: middleware.JSONLog, Output: &buf}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(middleware.RequestIDHeader, tc.Header)
+		tc.Chain(config).Then(okHandler)(httptest.NewRecorder(), r)
+
+		if tc.Result == "" && strings.Contains(buf.String(), "request_id") {
+			t.Errorf("case %s failed. no ID expected, got %s", tc.Name, buf.String())
+		}
+
+		if tc.Result != "" && !strings.Contains(buf.String(), tc.Result) {
+			t.Errorf("case %s failed. %s expected, got %s", tc.Name, tc.Result, buf.String())
+		}
+	}
+}
+
+func TestAccessLogRequestIDLine(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Format middleware.AccessLogFormat
+		Header string
+		Result string
+	}{
+		{Name: "common", Format: middleware.CommonLog, Header: "abc", Result: ` "abc"` + "\n"},
+		{Name: "combined", Format: middleware.CombinedLog, Header: "abc", Result: ` "abc"` + "\n"},
+		{Name: "invalid header", Format: middleware.CommonLog, Header: "abc\" 500", Result: ` "-"` + "\n"},
+	}
+
+	for _, tc := range tt {
+		var buf bytes.Buffer
+		config := middleware.AccessLogConfig{Format: tc.Format, Output: &buf}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(middleware.RequestIDHeader, tc.Header)
+		middleware.NewChain(middleware.AccessLog(config)).Then(okHandler)(httptest.NewRecorder(), r)
+
+		if !strings.HasSuffix(buf.String(), tc.Result) {
+			t.Errorf("case %s failed. line should end with %q, got %q", tc.Name, tc.Result, buf.String())
+		}
+	}
+}
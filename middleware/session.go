@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/anihex/server-utils/tools"
+	"github.com/anihex/server-utils/views"
+)
+
+// sessionWriter stores the session right before the headers are written.
+type sessionWriter struct {
+	http.ResponseWriter
+	session   cookie.Cookie
+	r         *http.Request
+	committed bool
+}
+
+// commit stores the session if it wasn't stored yet. Errors of cookies that
+// report them are logged, the response can't tell about them anymore.
+func (sw *sessionWriter) commit() {
+	if sw.committed || sw.session == nil {
+		return
+	}
+
+	sw.committed = true
+	sw.session.Store()
+
+	if s, ok := sw.session.(interface{ Err() error }); ok && s.Err() != nil && logger != nil {
+		logger.Log(sw.r.Context(), tools.LevelError, "session not stored", tools.F("error", s.Err().Error()))
+	}
+}
+
+// WriteHeader stores the session and writes the header.
+func (sw *sessionWriter) WriteHeader(status int) {
+	sw.commit()
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Write stores the session and writes the body.
+func (sw *sessionWriter) Write(b []byte) (int, error) {
+	sw.commit()
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush stores the session and flushes the response, if the underlying
+// ResponseWriter supports it.
+func (sw *sessionWriter) Flush() {
+	sw.commit()
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack stores the session and takes over the connection, e.g. for
+// websockets. It fails if the underlying ResponseWriter doesn't support it.
+func (sw *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: ResponseWriter doesn't support hijacking")
+	}
+
+	sw.commit()
+
+	return h.Hijack()
+}
+
+// Push starts a HTTP/2 server push, if the underlying ResponseWriter supports
+// it.
+func (sw *sessionWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := sw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// Session loads the session with the given cookie name and adds it to the
+// request context. GetSession returns it inside the handler. The session is
+// stored automatically before the headers are written, so handlers don't need
+// to call Store.
+func Session(newCookie cookie.CookieFunc, Name string) func(f http.HandlerFunc) http.HandlerFunc {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			sw := &sessionWriter{ResponseWriter: w, r: r}
+
+			session, err := newCookie(sw, r, Name)
+			if views.ServerErrorIfErr(w, r, err) {
+				return
+			}
+			sw.session = session
+
+			ctx := context.WithValue(r.Context(), sessionKey, session)
+
+			f(sw, r.WithContext(ctx))
+
+			sw.commit()
+		}
+	}
+}
+
+// GetSession returns the session that was added to the request by the Session
+// middleware. The result is nil if there is no session.
+func GetSession(r *http.Request) cookie.Cookie {
+	session, _ := r.Context().Value(sessionKey).(cookie.Cookie)
+
+	return session
+}
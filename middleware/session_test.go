@@ -0,0 +1,244 @@
+package middleware_test
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/cookie"
+	"github.com/anihex/server-utils/middleware"
+	"github.com/anihex/server-utils/tools"
+)
+
+// sessionCookie returns the session cookie of a response.
+func sessionCookie(resp *http.Response) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == "demo" {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// probeRecorder is a ResponseRecorder that calls probe when the response is
+// written the first time.
+type probeRecorder struct {
+	*httptest.ResponseRecorder
+	probe   func() bool
+	written bool
+	stored  bool
+}
+
+func (pr *probeRecorder) check() {
+	if !pr.written {
+		pr.written = true
+		pr.stored = pr.probe()
+	}
+}
+
+func (pr *probeRecorder) WriteHeader(status int) {
+	pr.check()
+	pr.ResponseRecorder.WriteHeader(status)
+}
+
+func (pr *probeRecorder) Write(b []byte) (int, error) {
+	pr.check()
+	return pr.ResponseRecorder.Write(b)
+}
+
+func (pr *probeRecorder) Flush() {
+	pr.check()
+	pr.ResponseRecorder.Flush()
+}
+
+// hijackRecorder is a ResponseRecorder that supports hijacking and server
+// push.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+	pushed   []string
+}
+
+func (hr *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hr.hijacked = true
+	server, client := net.Pipe()
+	client.Close()
+
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+func (hr *hijackRecorder) Push(target string, opts *http.PushOptions) error {
+	hr.pushed = append(hr.pushed, target)
+	return nil
+}
+
+func TestSession(t *testing.T) {
+	tt := []struct {
+		Name    string
+		Handler func(w http.ResponseWriter, r *http.Request)
+	}{
+		{
+			Name: "WriteHeader",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			Name: "Write",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			},
+		},
+		{
+			Name: "Flush",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.(http.Flusher).Flush()
+			},
+		},
+		{
+			Name:    "no response",
+			Handler: func(w http.ResponseWriter, r *http.Request) {},
+		},
+	}
+
+	for _, tc := range tt {
+		// Buffered sessions write nothing before they are stored
+		store := cookie.NewMemoryStore()
+		session := middleware.Session(cookie.New(store, cookie.Buffered()), "demo")
+
+		var id string
+		stored := func() bool {
+			values, _ := store.GetAll(id)
+			_, ok := values["name"]
+			return ok
+		}
+
+		pr := &probeRecorder{ResponseRecorder: httptest.NewRecorder(), probe: stored}
+		session(func(w http.ResponseWriter, r *http.Request) {
+			id = middleware.GetSession(r).GetSessionID()
+			middleware.GetSession(r).SetValue("name", tc.Name)
+			tc.Handler(w, r)
+		})(pr, httptest.NewRequest("GET", "/", nil))
+
+		if pr.written && !pr.stored {
+			t.Errorf("case %s failed. the session should be stored before the response", tc.Name)
+		}
+
+		if !stored() {
+			t.Errorf("case %s failed. the session should be stored", tc.Name)
+		}
+
+		c := sessionCookie(pr.Result())
+		if c == nil {
+			t.Errorf("case %s failed. session cookie expected", tc.Name)
+			continue
+		}
+
+		var name string
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(c)
+		session(func(w http.ResponseWriter, r *http.Request) {
+			name = middleware.GetSession(r).GetString("name")
+		})(httptest.NewRecorder(), r)
+
+		if name != tc.Name {
+			t.Errorf("case %s failed. '%s' expected, got '%s'", tc.Name, tc.Name, name)
+		}
+	}
+}
+
+func TestSessionUnused(t *testing.T) {
+	for name, opts := range map[string][]cookie.Option{"unbuffered": nil, "buffered": {cookie.Buffered()}} {
+		store := cookie.NewMemoryStore()
+		session := middleware.Session(cookie.New(store, opts...), "demo")
+
+		for i := 0; i < 5; i++ {
+			var id string
+			w := httptest.NewRecorder()
+			session(func(w http.ResponseWriter, r *http.Request) {
+				id = middleware.GetSession(r).GetSessionID()
+				w.Write([]byte("hello"))
+			})(w, httptest.NewRequest("GET", "/", nil))
+
+			if exists, _ := store.Exists(id); exists {
+				t.Errorf("case %s failed. unused sessions should not be stored", name)
+			}
+
+			if sessionCookie(w.Result()) != nil {
+				t.Errorf("case %s failed. unused sessions should not send a cookie", name)
+			}
+		}
+	}
+}
+
+// failingBatcher is a store that can't write buffered changes.
+type failingBatcher struct {
+	*cookie.MemoryStore
+}
+
+func (s failingBatcher) Apply(id string, set map[string][]byte, del []string, ttl time.Duration) error {
+	return errors.New("store is down")
+}
+
+func TestSessionStoreError(t *testing.T) {
+	logger := &tools.RecordLogger{}
+	middleware.SetLogger(logger)
+	defer middleware.SetLog(tools.DefaultLogger)
+
+	session := middleware.Session(cookie.New(failingBatcher{cookie.NewMemoryStore()}, cookie.Buffered()), "demo")
+	session(func(w http.ResponseWriter, r *http.Request) {
+		middleware.GetSession(r).SetValue("name", "demo")
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if len(logger.Entries()) != 1 {
+		t.Fatalf("1 entry expected, got %d", len(logger.Entries()))
+	}
+
+	entry := logger.Entries()[0]
+	if entry.Level != tools.LevelError || entry.Fields["error"] != "store is down" {
+		t.Errorf("the error of the store should be logged, got %+v", entry)
+	}
+}
+
+func TestGetSessionWithoutMiddleware(t *testing.T) {
+	if session := middleware.GetSession(httptest.NewRequest("GET", "/", nil)); session != nil {
+		t.Errorf("nil expected, got %v", session)
+	}
+}
+
+func TestSessionWriterInterfaces(t *testing.T) {
+	session := middleware.Session(cookie.New(cookie.NewMemoryStore()), "demo")
+
+	hr := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	session(func(w http.ResponseWriter, r *http.Request) {
+		if err := w.(http.Pusher).Push("/app.js", nil); err != nil {
+			t.Errorf("push failed: %v", err)
+		}
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatalf("hijack failed: %v", err)
+		}
+		conn.Close()
+	})(hr, httptest.NewRequest("GET", "/", nil))
+
+	if !hr.hijacked || len(hr.pushed) != 1 {
+		t.Errorf("hijack and push should be passed on, got %v and %v", hr.hijacked, hr.pushed)
+	}
+
+	// A ResponseWriter without support reports errors
+	session(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			t.Error("hijack should fail")
+		}
+
+		if err := w.(http.Pusher).Push("/app.js", nil); err != http.ErrNotSupported {
+			t.Errorf("ErrNotSupported expected, got %v", err)
+		}
+	})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -8,14 +8,16 @@ import (
 	"github.com/anihex/server-utils/tools"
 )
 
+// timeKey is the context key of the start time. The views read it to log the
+// time it took to send a response.
+const timeKey tools.TimeType = 1
+
 // Time adds the current time to the context
 func Time(f http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var timer tools.TimeType = 1
-
 		ctx := context.WithValue(
 			r.Context(),
-			timer,
+			timeKey,
 			time.Now(),
 		)
 
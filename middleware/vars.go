@@ -6,9 +6,21 @@ import (
 	"github.com/anihex/server-utils/tools"
 )
 
-var lg *log.Logger = tools.DefaultLogger
+// logger is the structured logger of the package.
+var logger tools.Logger = tools.NewStdLogger(tools.DefaultLogger)
 
-// SetLog sets the package logger
-func SetLog(logger *log.Logger) {
-	lg = logger
+// SetLog sets the package logger. The entries are written as logfmt lines,
+// nil disables logging.
+func SetLog(l *log.Logger) {
+	if l == nil {
+		logger = nil
+		return
+	}
+
+	logger = tools.NewStdLogger(l)
+}
+
+// SetLogger sets a structured logger for the package. Nil disables logging.
+func SetLogger(l tools.Logger) {
+	logger = l
 }
@@ -0,0 +1,208 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Level is the severity of a log entry. The values are the same as the ones
+// of log/slog.
+type Level int
+
+// The levels of a Logger.
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+// String returns the name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// StatusLevel returns the level of a response with the given status code.
+// Server errors are errors, client errors are warnings.
+func StatusLevel(status int) Level {
+	switch {
+	case status >= 500:
+		return LevelError
+	case status >= 400:
+		return LevelWarn
+	}
+
+	return LevelInfo
+}
+
+// Field is a key/value pair of a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger writes structured log entries. Implementations add the fields of the
+// context (see WithFields) before the given fields.
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// logCtx is the type of the context keys of the logger.
+type logCtx int
+
+// fieldsKey is the context key of the fields of WithFields.
+const fieldsKey logCtx = 0
+
+// WithFields returns a context with fields that are added to every entry that
+// is logged with it, e.g. the ID of the request.
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	old := ContextFields(ctx)
+
+	all := make([]Field, 0, len(old)+len(fields))
+	all = append(all, old...)
+	all = append(all, fields...)
+
+	return context.WithValue(ctx, fieldsKey, all)
+}
+
+// ContextFields returns the fields that were added to the context by
+// WithFields.
+func ContextFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(fieldsKey).([]Field)
+
+	return fields
+}
+
+// stdLogger adapts a log.Logger.
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger adapts a log.Logger. Entries are written as logfmt lines like
+// `level=INFO msg=response status=200`, the prefix and the flags of the logger
+// stay as they are.
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l: l}
+}
+
+// Log writes an entry as a logfmt line.
+func (s *stdLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	var b strings.Builder
+
+	b.WriteString("level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(logfmtValue(msg))
+
+	for _, list := range [][]Field{ContextFields(ctx), fields} {
+		for _, f := range list {
+			b.WriteString(" ")
+			b.WriteString(f.Key)
+			b.WriteString("=")
+			b.WriteString(logfmtValue(f.Value))
+		}
+	}
+
+	s.l.Print(b.String())
+}
+
+// Entry is a log entry of a RecordLogger. The fields of the context and the
+// given fields are merged into Fields.
+type Entry struct {
+	Level  Level
+	Msg    string
+	Fields map[string]interface{}
+}
+
+// RecordLogger keeps the entries that are logged instead of writing them, e.g.
+// to check them in tests. The zero value is ready to use and it is safe for
+// concurrent use.
+type RecordLogger struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Log keeps an entry.
+func (r *RecordLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	entry := Entry{Level: level, Msg: msg, Fields: make(map[string]interface{})}
+	for _, list := range [][]Field{ContextFields(ctx), fields} {
+		for _, f := range list {
+			entry.Fields[f.Key] = f.Value
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, entry)
+}
+
+// Entries returns the entries that were logged so far.
+func (r *RecordLogger) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Entry(nil), r.entries...)
+}
+
+// Reset removes all entries.
+func (r *RecordLogger) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = nil
+}
+
+// logfmtValue formats a value of a logfmt line. Values with spaces, quotes or
+// other special characters are quoted.
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	special := func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || r == '\\' || !unicode.IsPrint(r)
+	}
+
+	if s == "" || strings.IndexFunc(s, special) >= 0 {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
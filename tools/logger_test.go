@@ -0,0 +1,128 @@
+package tools_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+func TestStdLogger(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Level  tools.Level
+		Msg    string
+		Fields []tools.Field
+		Result string
+	}{
+		{
+			Name:   "no fields",
+			Level:  tools.LevelInfo,
+			Msg:    "response",
+			Result: "level=INFO msg=response\n",
+		},
+		{
+			Name:   "plain values",
+			Level:  tools.LevelWarn,
+			Msg:    "response",
+			Fields: []tools.Field{tools.F("status", 404), tools.F("uri", "/users?id=5")},
+			Result: "level=WARN msg=response status=404 uri=\"/users?id=5\"\n",
+		},
+		{
+			Name:   "quoted values",
+			Level:  tools.LevelError,
+			Msg:    "request failed",
+			Fields: []tools.Field{tools.F("error", errors.New(`no "user"`)), tools.F("empty", "")},
+			Result: "level=ERROR msg=\"request failed\" error=\"no \\\"user\\\"\" empty=\"\"\n",
+		},
+		{
+			Name:   "stringer",
+			Level:  tools.LevelDebug,
+			Msg:    "response",
+			Fields: []tools.Field{tools.F("latency", 1500*time.Millisecond)},
+			Result: "level=DEBUG msg=response latency=1.5s\n",
+		},
+	}
+
+	for _, tc := range tt {
+		var buf bytes.Buffer
+		logger := tools.NewStdLogger(log.New(&buf, "", 0))
+
+		logger.Log(context.Background(), tc.Level, tc.Msg, tc.Fields...)
+		if buf.String() != tc.Result {
+			t.Errorf("case %s failed. %q expected, got %q", tc.Name, tc.Result, buf.String())
+		}
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := tools.NewStdLogger(log.New(&buf, "", 0))
+
+	ctx := tools.WithFields(context.Background(), tools.F("request_id", "abc"))
+	child := tools.WithFields(ctx, tools.F("user", "alice"))
+
+	logger.Log(child, tools.LevelInfo, "login", tools.F("status", 200))
+
+	expected := "level=INFO msg=login request_id=abc user=alice status=200\n"
+	if buf.String() != expected {
+		t.Errorf("%q expected, got %q", expected, buf.String())
+	}
+
+	// The parent context keeps it's fields
+	if fields := tools.ContextFields(ctx); len(fields) != 1 {
+		t.Errorf("1 field expected, got %d", len(fields))
+	}
+
+	if fields := tools.ContextFields(nil); fields != nil {
+		t.Errorf("no fields expected, got %v", fields)
+	}
+}
+
+func TestRecordLogger(t *testing.T) {
+	logger := &tools.RecordLogger{}
+
+	ctx := tools.WithFields(context.Background(), tools.F("request_id", "abc"))
+	logger.Log(ctx, tools.LevelWarn, "response", tools.F("status", 404))
+
+	entries := logger.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("1 entry expected, got %d", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Level != tools.LevelWarn || entry.Msg != "response" {
+		t.Errorf("WARN response expected, got %s %s", entry.Level, entry.Msg)
+	}
+
+	if entry.Fields["request_id"] != "abc" || entry.Fields["status"] != 404 {
+		t.Errorf("fields of the context and the entry expected, got %v", entry.Fields)
+	}
+
+	logger.Reset()
+	if entries := logger.Entries(); len(entries) != 0 {
+		t.Errorf("no entries expected after Reset, got %v", entries)
+	}
+}
+
+func TestStatusLevel(t *testing.T) {
+	tt := []struct {
+		Status int
+		Level  tools.Level
+	}{
+		{Status: 200, Level: tools.LevelInfo},
+		{Status: 303, Level: tools.LevelInfo},
+		{Status: 404, Level: tools.LevelWarn},
+		{Status: 500, Level: tools.LevelError},
+	}
+
+	for _, tc := range tt {
+		if level := tools.StatusLevel(tc.Status); level != tc.Level {
+			t.Errorf("status %d: %s expected, got %s", tc.Status, tc.Level, level)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"net"
 	"net/http"
 	"strings"
 )
@@ -28,3 +29,14 @@ func GetIP(r *http.Request) (result string) {
 
 	return
 }
+
+// ClientIP returns the IP of the client without the port. If GetIP returns a
+// list of X-Forwarded-For, the first address is the client.
+func ClientIP(r *http.Request) string {
+	ip := strings.TrimSpace(strings.Split(GetIP(r), ",")[0])
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return host
+	}
+
+	return ip
+}
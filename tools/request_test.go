@@ -0,0 +1,34 @@
+package tools_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+func TestClientIP(t *testing.T) {
+	tt := []struct {
+		Name    string
+		Remote  string
+		Headers map[string]string
+		Result  string
+	}{
+		{Name: "remote address", Remote: "192.0.2.1:1234", Result: "192.0.2.1"},
+		{Name: "IPv6", Remote: "[2001:db8::1]:1234", Result: "2001:db8::1"},
+		{Name: "real IP", Remote: "10.0.0.1:1234", Headers: map[string]string{"X-Real-IP": "192.0.2.2"}, Result: "192.0.2.2"},
+		{Name: "forwarded list", Remote: "10.0.0.1:1234", Headers: map[string]string{"X-Forwarded-For": "192.0.2.3, 10.0.0.2"}, Result: "192.0.2.3"},
+	}
+
+	for _, tc := range tt {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.Remote
+		for key, value := range tc.Headers {
+			r.Header.Set(key, value)
+		}
+
+		if result := tools.ClientIP(r); result != tc.Result {
+			t.Errorf("case %s failed. '%s' expected, got '%s'", tc.Name, tc.Result, result)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package tools
+
+import (
+	"crypto/rand"
+)
+
+// SecureGID creates a new "GID" like GID does, but it uses crypto/rand as the
+// source of randomness. This makes the result unpredictable, so it can be used
+// for session tokens and the like.
+// It panics if crypto/rand fails to deliver random bytes.
+func SecureGID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("tools: crypto/rand failed: " + err.Error())
+	}
+
+	// 256 is a multiple of 64, so using the lower 6 bits of every random byte
+	// selects each letter with the same probability.
+	for i := range b {
+		b[i] = letterBytes[b[i]&letterIdxMask]
+	}
+
+	return string(b)
+}
@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSecureGID(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Length int
+	}{
+		{Name: "empty", Length: 0},
+		{Name: "short", Length: 11},
+		{Name: "session token", Length: 32},
+		{Name: "long", Length: 1000},
+	}
+
+	for _, tc := range tt {
+		gid := SecureGID(tc.Length)
+		if len(gid) != tc.Length {
+			t.Errorf("case %s failed. length %d expected, got %d", tc.Name, tc.Length, len(gid))
+		}
+
+		for _, c := range gid {
+			if !strings.ContainsRune(letterBytes, c) {
+				t.Errorf("case %s failed. '%c' is not a valid character", tc.Name, c)
+			}
+		}
+	}
+}
+
+func TestSecureGIDDistribution(t *testing.T) {
+	const perLetter = 2000
+
+	counts := make(map[rune]int, len(letterBytes))
+	for _, c := range SecureGID(len(letterBytes) * perLetter) {
+		counts[c]++
+	}
+
+	// Chi-squared test with 63 degrees of freedom. 110 is well above the
+	// critical value for p = 0.0001 (~ 108).
+	var chi2 float64
+	for _, c := range letterBytes {
+		diff := float64(counts[c] - perLetter)
+		chi2 += diff * diff / perLetter
+	}
+
+	if chi2 > 110 {
+		t.Errorf("characters are not distributed uniformly; chi-squared is %f", chi2)
+	}
+}
+
+func TestSecureGIDSource(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "securegid.go", nil, parser.ImportsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if path == "math/rand" {
+			t.Error("securegid.go must not use math/rand")
+		}
+	}
+}
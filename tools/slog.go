@@ -0,0 +1,41 @@
+// +build go1.21
+
+package tools
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogLogger adapts a slog.Logger.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger adapts a slog.Logger. The fields are added as attributes and
+// the context is passed on to the handler.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+// Log passes an entry on to the slog.Logger.
+func (s slogLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if !s.l.Enabled(ctx, slog.Level(level)) {
+		return
+	}
+
+	contextFields := ContextFields(ctx)
+
+	attrs := make([]slog.Attr, 0, len(contextFields)+len(fields))
+	for _, list := range [][]Field{contextFields, fields} {
+		for _, f := range list {
+			attrs = append(attrs, slog.Any(f.Key, f.Value))
+		}
+	}
+
+	s.l.LogAttrs(ctx, slog.Level(level), msg, attrs...)
+}
@@ -0,0 +1,46 @@
+// +build go1.21
+
+package tools_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	logger := tools.NewSlogLogger(slog.New(handler))
+
+	ctx := tools.WithFields(context.Background(), tools.F("request_id", "abc"))
+
+	logger.Log(ctx, tools.LevelDebug, "hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("debug entry should be skipped, got %q", buf.String())
+	}
+
+	logger.Log(ctx, tools.LevelWarn, "response", tools.F("status", 404))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"level":      "WARN",
+		"msg":        "response",
+		"request_id": "abc",
+		"status":     float64(404),
+	}
+
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("%s: %v expected, got %v", key, value, entry[key])
+		}
+	}
+}
@@ -2,7 +2,6 @@ package views
 
 import (
 	"net/http"
-	"strings"
 )
 
 // SendBytes sends bytes over HTTP. It uses the given content-type and the
@@ -12,7 +11,5 @@ func SendBytes(w http.ResponseWriter, r *http.Request, data []byte, ContentType
 	w.WriteHeader(Status)
 	w.Write(data)
 
-	if !strings.HasPrefix(r.RequestURI, "/status") && TEST_MODE == false {
-		Logger.Printf("[%7s] [%d] %s\n [Bytes Send]", r.Method, Status, r.RequestURI)
-	}
+	logResponse(r, 1, "bytes", Status)
 }
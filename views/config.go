@@ -1,8 +1,59 @@
 package views
 
 import (
+	"log"
+
 	"github.com/anihex/server-utils/tools"
 )
 
 var TEST_MODE bool = false
+
+// Logger receives the log entries of the views as logfmt lines, unless a
+// structured logger was set with SetLogger. It should be changed with SetLog.
 var Logger = tools.DefaultLogger
+
+// logger is the structured logger of SetLogger.
+var logger tools.Logger
+
+// stdLogger is the adapter of stdSource, which was set by SetLog. It is
+// created once instead of for every response.
+var (
+	stdSource = tools.DefaultLogger
+	stdLogger = tools.NewStdLogger(tools.DefaultLogger)
+)
+
+// SetLog sets the Logger of the views. Nil disables logging, unless a
+// structured logger is set.
+func SetLog(l *log.Logger) {
+	Logger = l
+	stdSource = l
+	stdLogger = nil
+
+	if l != nil {
+		stdLogger = tools.NewStdLogger(l)
+	}
+}
+
+// SetLogger sets a structured logger for the views. Nil uses Logger again.
+func SetLogger(l tools.Logger) {
+	logger = l
+}
+
+// getLogger returns the logger of the views. The result is nil if logging is
+// disabled.
+func getLogger() tools.Logger {
+	if logger != nil {
+		return logger
+	}
+
+	if Logger == nil {
+		return nil
+	}
+
+	if Logger == stdSource {
+		return stdLogger
+	}
+
+	// Logger was replaced without SetLog
+	return tools.NewStdLogger(Logger)
+}
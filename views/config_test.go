@@ -0,0 +1,29 @@
+package views
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+func TestGetLoggerCached(t *testing.T) {
+	defer SetLog(tools.DefaultLogger)
+
+	SetLog(log.New(os.Stderr, "", 0))
+	if first := getLogger(); first == nil || first != getLogger() {
+		t.Error("the logger of SetLog should be created only once")
+	}
+
+	// Logger can still be replaced without SetLog
+	Logger = log.New(os.Stderr, "views ", 0)
+	if l := getLogger(); l == nil || l == stdLogger {
+		t.Error("a replaced Logger should be used")
+	}
+
+	SetLog(nil)
+	if l := getLogger(); l != nil {
+		t.Errorf("no logger expected, got %v", l)
+	}
+}
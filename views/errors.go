@@ -4,9 +4,6 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"path/filepath"
-	"runtime"
-	"strings"
 	"time"
 
 	"github.com/anihex/server-utils/tools"
@@ -64,31 +61,11 @@ func prepContext(r *http.Request) *http.Request {
 }
 
 func sendError(w http.ResponseWriter, r *http.Request, err error, status int, data []byte) {
-	skip := getSkipFile(r)
-	elapsedTime := getTime(r)
-
-	_, filename, line, _ := runtime.Caller(skip + 1)
-	filename = filepath.Base(filename)
-
-	RemoteAddr := tools.GetIP(r)
-
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
 	w.Write(data)
 
-	if !strings.HasPrefix(r.RequestURI, "/status") && TEST_MODE == false {
-		Logger.Printf(
-			"[%7s] [%s; Line %d] [JSON] [%d] [%s] [%v] %s (%s)",
-			r.Method,
-			filename,
-			line,
-			status,
-			RemoteAddr,
-			elapsedTime,
-			r.RequestURI,
-			err,
-		)
-	}
+	logResponse(r, getSkipFile(r)+1, "json", status, tools.F("error", err))
 }
 
 // AccessDeniedWithErr sends an error message with "Forbidden" as it's
@@ -320,3 +297,35 @@ func BadRequestIfErr(w http.ResponseWriter, r *http.Request, err error) bool {
 
 	return false
 }
+
+// CSRFWithErr sends an error message with "Forbidden" as it's status code.
+// It also sends a JSON Object with the error-message "ERR_CSRF".
+// The error message will be displayed in the log.
+func CSRFWithErr(w http.ResponseWriter, r *http.Request, err error) {
+	data := []byte(`{ "error": "ERR_CSRF" }`)
+
+	sendError(w, r, err, http.StatusForbidden, data)
+}
+
+// ErrCSRF sends an error message with "Forbidden" as it's status code.
+// It also sends a JSON Object with the error-message "ERR_CSRF".
+// It uses the default error message for an invalid CSRF token.
+func ErrCSRF(w http.ResponseWriter, r *http.Request) {
+	err := errors.New("Invalid CSRF Token")
+	res := prepContext(r)
+	CSRFWithErr(w, res, err)
+}
+
+// CSRFIfErr send an ERR_CSRF to the client IF the passed err is not nil. In
+// this case error will be placed into the context and logged.
+// If a Response was send, the result will be true to indicate, that no further
+// request handling is necessary.
+func CSRFIfErr(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err != nil {
+		res := prepContext(r)
+		CSRFWithErr(w, res, err)
+		return true
+	}
+
+	return false
+}
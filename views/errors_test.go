@@ -0,0 +1,65 @@
+package views_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anihex/server-utils/views"
+)
+
+func TestCSRFErrors(t *testing.T) {
+	views.TEST_MODE = true
+	defer func() { views.TEST_MODE = false }()
+
+	tt := []struct {
+		Name string
+		Send func(w http.ResponseWriter, r *http.Request)
+	}{
+		{
+			Name: "CSRFWithErr",
+			Send: func(w http.ResponseWriter, r *http.Request) {
+				views.CSRFWithErr(w, r, errors.New("CSRF token missing"))
+			},
+		},
+		{
+			Name: "ErrCSRF",
+			Send: views.ErrCSRF,
+		},
+		{
+			Name: "CSRFIfErr",
+			Send: func(w http.ResponseWriter, r *http.Request) {
+				if !views.CSRFIfErr(w, r, errors.New("CSRF token invalid")) {
+					t.Error("CSRFIfErr should report the response")
+				}
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		w := httptest.NewRecorder()
+		tc.Send(w, httptest.NewRequest("POST", "/", nil))
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("case %s failed. status %d expected, got %d", tc.Name, http.StatusForbidden, w.Code)
+		}
+
+		if body := w.Body.String(); body != `{ "error": "ERR_CSRF" }` {
+			t.Errorf("case %s failed. ERR_CSRF expected, got %s", tc.Name, body)
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("case %s failed. JSON expected, got %s", tc.Name, ct)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if views.CSRFIfErr(w, httptest.NewRequest("POST", "/", nil), nil) {
+		t.Error("CSRFIfErr shouldn't respond without an error")
+	}
+
+	if w.Body.Len() != 0 {
+		t.Errorf("no response expected, got %s", w.Body.String())
+	}
+}
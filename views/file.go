@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 
 	"github.com/anihex/server-utils/tools"
 )
@@ -25,16 +24,11 @@ func fileExists(Filename string) bool {
 // SendFile sends the given file to the client if the file was found and can be
 // accessed. Otherwise it will send a "Not Found".
 func SendFile(w http.ResponseWriter, r *http.Request, FileName string) {
-	_, filename, line, _ := runtime.Caller(1)
-	filename = filepath.Base(filename)
-
-	RemoteAddr := tools.GetIP(r)
-
 	if !fileExists(FileName) {
 		w.WriteHeader(http.StatusNotFound)
-		Logger.Printf("[%7s] [%s; Line %d] [File] [%d] [%s] %s", r.Method, filename, line, http.StatusNotFound, RemoteAddr, r.RequestURI)
+		logResponse(r, 1, "file", http.StatusNotFound, tools.F("file", filepath.Base(FileName)))
 	} else {
-		Logger.Printf("[%7s] [%s; Line %d] [File] [%d] [%s] %s", r.Method, filename, line, http.StatusOK, RemoteAddr, r.RequestURI)
+		logResponse(r, 1, "file", http.StatusOK, tools.F("file", filepath.Base(FileName)))
 		http.ServeFile(w, r, FileName)
 	}
 }
@@ -2,9 +2,6 @@ package views
 
 import (
 	"net/http"
-	"path/filepath"
-	"runtime"
-	"strings"
 
 	"github.com/anihex/json"
 	"github.com/anihex/server-utils/tools"
@@ -25,27 +22,9 @@ func SendJSON(w http.ResponseWriter, r *http.Request, o interface{}, Status int)
 // send takes a byte Array and sends it to the client using the given
 // Content-Type and the given Status-Code.
 func send(w http.ResponseWriter, r *http.Request, data []byte, ContentType string, Status int) {
-	RemoteAddr := tools.GetIP(r)
-	_, filename, line, _ := runtime.Caller(2)
-	filename = filepath.Base(filename)
-
 	w.Header().Set("Content-Type", ContentType)
 	w.WriteHeader(Status)
-
-	timeElapsed := getTime(r)
-
 	w.Write(data)
 
-	if !strings.HasPrefix(r.RequestURI, "/status") && TEST_MODE == false {
-		Logger.Printf(
-			"[%7s] [%s; Line %d] [JSON] [%d] [%s] [%v] %s\n",
-			r.Method,
-			filename,
-			line,
-			Status,
-			RemoteAddr,
-			timeElapsed,
-			r.RequestURI,
-		)
-	}
+	logResponse(r, 2, "json", Status)
 }
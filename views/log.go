@@ -0,0 +1,45 @@
+package views
+
+import (
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anihex/server-utils/tools"
+)
+
+// logResponse logs a response that was sent by a view. Every view uses the
+// same fields, so the entries can be filtered by them. Skip is used like the
+// argument of runtime.Caller in the view, the "caller" field is the file and
+// line of the handler.
+func logResponse(r *http.Request, skip int, kind string, status int, fields ...tools.Field) {
+	if strings.HasPrefix(r.RequestURI, "/status") || TEST_MODE {
+		return
+	}
+
+	l := getLogger()
+	if l == nil {
+		return
+	}
+
+	all := []tools.Field{
+		tools.F("type", kind),
+		tools.F("method", r.Method),
+		tools.F("uri", r.RequestURI),
+		tools.F("status", status),
+		tools.F("remote_ip", tools.ClientIP(r)),
+	}
+
+	if _, filename, line, ok := runtime.Caller(skip + 1); ok {
+		all = append(all, tools.F("caller", filepath.Base(filename)+":"+strconv.Itoa(line)))
+	}
+
+	if elapsed := getTime(r); elapsed > 0 {
+		all = append(all, tools.F("latency_ms", float64(elapsed)/float64(time.Millisecond)))
+	}
+
+	l.Log(r.Context(), tools.StatusLevel(status), "response", append(all, fields...)...)
+}
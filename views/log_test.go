@@ -0,0 +1,236 @@
+package views_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anihex/server-utils/middleware"
+	"github.com/anihex/server-utils/tools"
+	"github.com/anihex/server-utils/views"
+)
+
+func TestLogFields(t *testing.T) {
+	logger := &tools.RecordLogger{}
+	views.SetLogger(logger)
+	defer views.SetLogger(nil)
+
+	tt := []struct {
+		Name   string
+		Send   func(w http.ResponseWriter, r *http.Request)
+		Type   string
+		Status int
+		Level  tools.Level
+		Extra  map[string]interface{}
+	}{
+		{
+			Name: "SendJSON",
+			Send: func(w http.ResponseWriter, r *http.Request) {
+				views.SendJSON(w, r, map[string]string{"a": "b"}, http.StatusOK)
+			},
+			Type:   "json",
+			Status: http.StatusOK,
+			Level:  tools.LevelInfo,
+		},
+		{
+			Name: "SendHeader",
+			Send: func(w http.ResponseWriter, r *http.Request) {
+				views.SendHeader(w, r, http.StatusNoContent)
+			},
+			Type:   "header",
+			Status: http.StatusNoContent,
+			Level:  tools.LevelInfo,
+		},
+		{
+			Name:   "ErrNotFound",
+			Send:   views.ErrNotFound,
+			Type:   "json",
+			Status: http.StatusNotFound,
+			Level:  tools.LevelWarn,
+			Extra:  map[string]interface{}{"error": "Not Found"},
+		},
+		{
+			Name: "ServerErrorIfErr",
+			Send: func(w http.ResponseWriter, r *http.Request) {
+				views.ServerErrorIfErr(w, r, errors.New("db down"))
+			},
+			Type:   "json",
+			Status: http.StatusInternalServerError,
+			Level:  tools.LevelError,
+			Extra:  map[string]interface{}{"error": "db down"},
+		},
+		{
+			Name: "Redirect",
+			Send: func(w http.ResponseWriter, r *http.Request) {
+				views.Redirect(w, r, false, "/login")
+			},
+			Type:   "redirect",
+			Status: http.StatusSeeOther,
+			Level:  tools.LevelInfo,
+			Extra:  map[string]interface{}{"location": "/login"},
+		},
+		{
+			Name: "SendFile",
+			Send: func(w http.ResponseWriter, r *http.Request) {
+				views.SendFile(w, r, "/does/not/exist.txt")
+			},
+			Type:   "file",
+			Status: http.StatusNotFound,
+			Level:  tools.LevelWarn,
+			Extra:  map[string]interface{}{"file": "exist.txt"},
+		},
+	}
+
+	for _, tc := range tt {
+		logger.Reset()
+
+		r := httptest.NewRequest("GET", "/items?page=2", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		tc.Send(httptest.NewRecorder(), r)
+
+		if len(logger.Entries()) != 1 {
+			t.Errorf("case %s failed. 1 entry expected, got %d", tc.Name, len(logger.Entries()))
+			continue
+		}
+
+		entry := logger.Entries()[0]
+		if entry.Msg != "response" || entry.Level != tc.Level {
+			t.Errorf("case %s failed. response with level %s expected, got %s with %s", tc.Name, tc.Level, entry.Msg, entry.Level)
+		}
+
+		fields := map[string]interface{}{
+			"type":      tc.Type,
+			"method":    "GET",
+			"uri":       "/items?page=2",
+			"status":    tc.Status,
+			"remote_ip": "192.0.2.1",
+		}
+		for k, v := range tc.Extra {
+			fields[k] = v
+		}
+
+		for k, v := range fields {
+			got := entry.Fields[k]
+			if err, ok := got.(error); ok {
+				got = err.Error()
+			}
+
+			if got != v {
+				t.Errorf("case %s failed. %s should be %v, got %v", tc.Name, k, v, got)
+			}
+		}
+
+		if caller, _ := entry.Fields["caller"].(string); !strings.HasPrefix(caller, "log_test.go:") {
+			t.Errorf("case %s failed. caller in log_test.go expected, got %q", tc.Name, caller)
+		}
+
+		if _, ok := entry.Fields["latency_ms"]; ok {
+			t.Errorf("case %s failed. no latency expected without the Time middleware", tc.Name)
+		}
+	}
+}
+
+func TestLogCaller(t *testing.T) {
+	logger := &tools.RecordLogger{}
+	views.SetLogger(logger)
+	defer views.SetLogger(nil)
+
+	r := httptest.NewRequest("GET", "/", nil)
+
+	_, _, line, _ := runtime.Caller(0)
+	views.NotFoundIfErr(httptest.NewRecorder(), r, errors.New("missing"))
+
+	if len(logger.Entries()) != 1 {
+		t.Fatalf("1 entry expected, got %d", len(logger.Entries()))
+	}
+
+	want := "log_test.go:" + strconv.Itoa(line+1)
+	if caller := logger.Entries()[0].Fields["caller"]; caller != want {
+		t.Errorf("caller %s expected, got %v", want, caller)
+	}
+}
+
+func TestLogLatency(t *testing.T) {
+	logger := &tools.RecordLogger{}
+	views.SetLogger(logger)
+	defer views.SetLogger(nil)
+
+	h := middleware.Time(func(w http.ResponseWriter, r *http.Request) {
+		views.SendHeader(w, r, http.StatusOK)
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if len(logger.Entries()) != 1 {
+		t.Fatalf("1 entry expected, got %d", len(logger.Entries()))
+	}
+
+	if latency, ok := logger.Entries()[0].Fields["latency_ms"].(float64); !ok || latency <= 0 {
+		t.Errorf("latency in milliseconds expected, got %v", logger.Entries()[0].Fields["latency_ms"])
+	}
+}
+
+func TestLogSkip(t *testing.T) {
+	logger := &tools.RecordLogger{}
+	views.SetLogger(logger)
+	defer views.SetLogger(nil)
+
+	views.SendHeader(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil), http.StatusOK)
+	if len(logger.Entries()) != 0 {
+		t.Errorf("/status shouldn't be logged, got %v", logger.Entries())
+	}
+
+	views.TEST_MODE = true
+	views.SendHeader(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), http.StatusOK)
+	views.TEST_MODE = false
+
+	if len(logger.Entries()) != 0 {
+		t.Errorf("nothing should be logged in TEST_MODE, got %v", logger.Entries())
+	}
+}
+
+func TestSetLog(t *testing.T) {
+	defer views.SetLog(tools.DefaultLogger)
+
+	var buf bytes.Buffer
+	views.SetLog(log.New(&buf, "", 0))
+
+	views.SendHeader(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil), http.StatusNotFound)
+
+	line := buf.String()
+	for _, part := range []string{"level=WARN", "msg=response", "type=header", "uri=/a", "status=404", "caller=log_test.go:"} {
+		if !strings.Contains(line, part) {
+			t.Errorf("%s expected in %q", part, line)
+		}
+	}
+
+	// A structured logger has priority, nil uses the log.Logger again
+	logger := &tools.RecordLogger{}
+	views.SetLogger(logger)
+	buf.Reset()
+	views.SendHeader(httptest.NewRecorder(), httptest.NewRequest("GET", "/b", nil), http.StatusOK)
+	views.SetLogger(nil)
+
+	if len(logger.Entries()) != 1 || buf.Len() != 0 {
+		t.Errorf("only the structured logger should be used, got %d entries and %q", len(logger.Entries()), buf.String())
+	}
+
+	views.SendHeader(httptest.NewRecorder(), httptest.NewRequest("GET", "/c", nil), http.StatusOK)
+	if !strings.Contains(buf.String(), "uri=/c") {
+		t.Errorf("the log.Logger should be used again, got %q", buf.String())
+	}
+
+	// Nil disables logging
+	views.SetLog(nil)
+	buf.Reset()
+	views.SendHeader(httptest.NewRecorder(), httptest.NewRequest("GET", "/d", nil), http.StatusOK)
+
+	if buf.Len() != 0 {
+		t.Errorf("nothing should be logged, got %q", buf.String())
+	}
+}